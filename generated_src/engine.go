@@ -0,0 +1,105 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amalgomatedformatter
+
+import (
+	gofmt "github.com/palantir/godel-format-asset-gofmt/generated_src/internal/cmd/gofmt"
+)
+
+// This file is not generated by amalgomate: it exposes the formatting engine of the amalgomated gofmt program so that
+// it can be used in-process rather than by re-executing the asset with the amalgomated proxy prefix.
+
+type (
+	// Options configures the formatting performed by FormatSource and FormatFile.
+	Options = gofmt.Options
+	// Result is the result of formatting a single file.
+	Result = gofmt.Result
+	// RewriteRule is a parsed rewrite rule of the form "pattern -> replacement".
+	RewriteRule = gofmt.RewriteRule
+	// DiffHunk is a hunk of a unified diff.
+	DiffHunk = gofmt.DiffHunk
+	// LineRange is an inclusive range of lines in a file numbered from 1.
+	LineRange = gofmt.LineRange
+)
+
+// ParseRewriteRule parses a rewrite rule of the form "pattern -> replacement". If name is empty, the text of the rule
+// is used as its name.
+func ParseRewriteRule(name, rule string) (RewriteRule, error) {
+	return gofmt.ParseRewriteRule(name, rule)
+}
+
+// Simplifications returns the names of the simplifications performed by "gofmt -s", which can be applied individually
+// using Options.Simplifications.
+func Simplifications() []string {
+	return gofmt.Simplifications()
+}
+
+// ExtraSimplifications returns the names of the extra simplifications, which are not performed by "gofmt -s" and are
+// only applied if they are named in Options.Simplifications.
+func ExtraSimplifications() []string {
+	return gofmt.ExtraSimplifications()
+}
+
+// FormatSource formats src, which was read from the named file.
+func FormatSource(filename string, src []byte, opts Options) Result {
+	return gofmt.Source(filename, src, opts)
+}
+
+// FormatFile reads and formats the named file.
+func FormatFile(filename string, opts Options) Result {
+	return gofmt.File(filename, opts)
+}
+
+// FormatFiles formats the named files using up to concurrency goroutines and calls fn with the result for each file in
+// the order in which the files were provided. If concurrency is less than 1, the value of runtime.GOMAXPROCS(0) is
+// used.
+func FormatFiles(filenames []string, opts Options, concurrency int, fn func(Result)) {
+	gofmt.Files(filenames, opts, concurrency, fn)
+}
+
+// FormatSources formats the content returned by read for each of the named files using up to concurrency goroutines
+// and calls fn with the result for each file in the order in which the files were provided. read is called
+// concurrently. If concurrency is less than 1, the value of runtime.GOMAXPROCS(0) is used.
+func FormatSources(filenames []string, read func(filename string) ([]byte, error), opts Options, concurrency int, fn func(Result)) {
+	gofmt.Sources(filenames, read, opts, concurrency, fn)
+}
+
+// DefaultDiffContext is the number of context lines "diff -u" prints around changes.
+const DefaultDiffContext = gofmt.DefaultDiffContext
+
+// UnifiedDiff returns the differences between a and b in the unified format produced by "diff -u". The header names
+// the files oldName and newName and contains no timestamps. Returns nil if a and b are equal. If context is negative,
+// DefaultDiffContext is used.
+func UnifiedDiff(oldName, newName string, a, b []byte, context int) []byte {
+	return gofmt.UnifiedDiff(oldName, newName, a, b, context)
+}
+
+// DiffHunks returns the hunks of the unified diff between a and b with the given number of context lines. Returns nil
+// if a and b are equal. If context is negative, DefaultDiffContext is used.
+func DiffHunks(a, b []byte, context int) []DiffHunk {
+	return gofmt.DiffHunks(a, b, context)
+}
+
+// TruncateDiff returns the unified diff d truncated to its first maxHunks hunks and the number of hunks that were
+// removed. If maxHunks is less than 1, d is returned unchanged.
+func TruncateDiff(d []byte, maxHunks int) ([]byte, int) {
+	return gofmt.TruncateDiff(d, maxHunks)
+}
+
+// SetReportHandler sets the function that the gofmt command calls with the values of its -report flags and the results
+// for the files that were processed. The -report flag is rejected unless a handler is set.
+func SetReportHandler(fn func(reports []string, results []Result) error) {
+	gofmt.ReportHandler = fn
+}
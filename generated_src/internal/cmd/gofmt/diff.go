@@ -0,0 +1,351 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amalgomated
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// DefaultDiffContext is the number of context lines "diff -u" prints around changes.
+const DefaultDiffContext = 3
+
+// DiffHunk is a hunk of a unified diff.
+type DiffHunk struct {
+	// OldStart and OldLines are the range of the hunk in the original content as printed in the hunk header: the
+	// 1-based number of the first line and the number of lines. If OldLines is 0, OldStart is the number of the line
+	// after which lines are added.
+	OldStart, OldLines	int
+	// NewStart and NewLines are the range of the hunk in the new content.
+	NewStart, NewLines	int
+	// Lines are the lines of the hunk without line terminators. Each line starts with ' ' for context lines, '-' for
+	// removed lines or '+' for added lines. A removed or added line that is not terminated by a newline is followed by
+	// the line "\ No newline at end of file".
+	Lines	[]string
+}
+
+// Header returns the header line of the hunk without a line terminator.
+func (h DiffHunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+// DiffHunks returns the hunks of the unified diff between a and b with the given number of context lines. Returns nil
+// if a and b are equal. If context is negative, DefaultDiffContext is used.
+func DiffHunks(a, b []byte, context int) []DiffHunk {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	if context < 0 {
+		context = DefaultDiffContext
+	}
+	x, y := splitLines(a), splitLines(b)
+
+	var diffHunks []DiffHunk
+	for _, h := range hunks(diffLines(x, y), len(x), len(y), context) {
+		dh := DiffHunk{
+			OldStart:	unifiedStart(h.x0, h.x1),
+			OldLines:	h.x1 - h.x0,
+			NewStart:	unifiedStart(h.y0, h.y1),
+			NewLines:	h.y1 - h.y0,
+		}
+		i, j := h.x0, h.y0
+		for _, e := range h.edits {
+			for ; i < e.x0; i, j = i+1, j+1 {
+				dh.Lines = appendDiffLine(dh.Lines, ' ', x[i])
+			}
+			for ; i < e.x1; i++ {
+				dh.Lines = appendDiffLine(dh.Lines, '-', x[i])
+			}
+			for ; j < e.y1; j++ {
+				dh.Lines = appendDiffLine(dh.Lines, '+', y[j])
+			}
+		}
+		for ; i < h.x1; i++ {
+			dh.Lines = appendDiffLine(dh.Lines, ' ', x[i])
+		}
+		diffHunks = append(diffHunks, dh)
+	}
+	return diffHunks
+}
+
+// UnifiedDiff returns the differences between a and b in the unified format produced by "diff -u". The header names
+// the files oldName and newName and contains no timestamps. Returns nil if a and b are equal. If context is negative,
+// DefaultDiffContext is used.
+func UnifiedDiff(oldName, newName string, a, b []byte, context int) []byte {
+	diffHunks := DiffHunks(a, b, context)
+	if diffHunks == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range diffHunks {
+		buf.WriteString(h.Header())
+		buf.WriteByte('\n')
+		for _, line := range h.Lines {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// TruncateDiff returns the unified diff d truncated to its first maxHunks hunks and the number of hunks that were
+// removed. If maxHunks is less than 1, d is returned unchanged.
+func TruncateDiff(d []byte, maxHunks int) ([]byte, int) {
+	if maxHunks < 1 {
+		return d, 0
+	}
+	hunks, end := 0, len(d)
+	for i, line := 0, d; len(line) > 0; {
+		// content lines start with ' ', '+', '-' or '\', so only hunk headers start with "@@"
+		if bytes.HasPrefix(line, []byte("@@ ")) {
+			if hunks == maxHunks {
+				end = i
+			}
+			hunks++
+		}
+		next := bytes.IndexByte(line, '\n') + 1
+		if next == 0 {
+			break
+		}
+		i, line = i+next, line[next:]
+	}
+	if hunks <= maxHunks {
+		return d, 0
+	}
+	return d[:end], hunks - maxHunks
+}
+
+// splitLines splits data into lines that retain their line terminator. The last line has no terminator if data does
+// not end with a newline.
+func splitLines(data []byte) [][]byte {
+	var lines [][]byte
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines = append(lines, data[:i])
+		data = data[i:]
+	}
+	return lines
+}
+
+func appendDiffLine(lines []string, op byte, line []byte) []string {
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		return append(lines, string(op)+string(line[:len(line)-1]))
+	}
+	return append(lines, string(op)+string(line), "\\ No newline at end of file")
+}
+
+// unifiedStart returns the start of the 0-based half-open line range [start, end) as printed in a unified diff: the
+// 1-based number of the first line or, for an empty range, of the line before it.
+func unifiedStart(start, end int) int {
+	if start == end {
+		return start
+	}
+	return start + 1
+}
+
+// hunkRange formats a range of a hunk header.
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// edit replaces the lines x[x0:x1] with the lines y[y0:y1]. Either range may be empty.
+type edit struct {
+	x0, x1, y0, y1 int
+}
+
+// hunk is a group of edits that are printed together with the surrounding context lines x[x0:x1] and y[y0:y1].
+type hunk struct {
+	x0, x1, y0, y1	int
+	edits		[]edit
+}
+
+// hunks groups edits that are separated by no more than 2*context unchanged lines.
+func hunks(edits []edit, nx, ny, context int) []hunk {
+	var hs []hunk
+	for _, e := range edits {
+		if n := len(hs); n > 0 && e.x0-hs[n-1].x1 <= context {
+			h := &hs[n-1]
+			h.x1, h.y1 = min(e.x1+context, nx), min(e.y1+context, ny)
+			h.edits = append(h.edits, e)
+			continue
+		}
+		before := min(context, min(e.x0, e.y0))
+		hs = append(hs, hunk{
+			x0:	e.x0 - before,
+			x1:	min(e.x1+context, nx),
+			y0:	e.y0 - before,
+			y1:	min(e.y1+context, ny),
+			edits:	[]edit{e},
+		})
+	}
+	return hs
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// diffCostLimit is the maximum number of edits for which split searches. Ranges of lines that require more edits are
+// replaced as a whole, which bounds the time taken to diff large files that have few lines in common.
+const diffCostLimit = 4096
+
+// diffLines returns the edits that transform x into y in increasing order. It uses the linear space variant of the Myers
+// diff algorithm, which recursively splits the lines at the middle of a shortest sequence of edits.
+func diffLines(x, y [][]byte) []edit {
+	// lines are compared by number: equal lines are assigned the same number
+	ids := make(map[string]int)
+	d := differ{
+		x:	lineIDs(x, ids),
+		y:	lineIDs(y, ids),
+	}
+	d.diff(0, len(x), 0, len(y))
+	return d.edits
+}
+
+// lineIDs returns the numbers assigned to lines by ids, assigning new numbers to lines that have none.
+func lineIDs(lines [][]byte, ids map[string]int) []int {
+	nums := make([]int, len(lines))
+	for i, line := range lines {
+		id, ok := ids[string(line)]
+		if !ok {
+			id = len(ids)
+			ids[string(line)] = id
+		}
+		nums[i] = id
+	}
+	return nums
+}
+
+// differ computes the edits between the numbered lines x and y.
+type differ struct {
+	x, y	[]int
+	edits	[]edit
+}
+
+// diff appends the edits that transform x[x0:x1] into y[y0:y1] to d.edits.
+func (d *differ) diff(x0, x1, y0, y1 int) {
+	// strip the common prefix and suffix, which are usually most of the file
+	for x0 < x1 && y0 < y1 && d.x[x0] == d.y[y0] {
+		x0, y0 = x0+1, y0+1
+	}
+	for x0 < x1 && y0 < y1 && d.x[x1-1] == d.y[y1-1] {
+		x1, y1 = x1-1, y1-1
+	}
+	if x0 == x1 && y0 == y1 {
+		return
+	}
+	if x0 < x1 && y0 < y1 {
+		if xm, ym, ok := d.split(x0, x1, y0, y1); ok {
+			d.diff(x0, xm, y0, ym)
+			d.diff(xm, x1, ym, y1)
+			return
+		}
+	}
+	d.add(edit{x0, x1, y0, y1})
+}
+
+// add appends e to d.edits or, if e is adjacent to the last edit, merges it into the last edit.
+func (d *differ) add(e edit) {
+	if n := len(d.edits); n > 0 && d.edits[n-1].x1 == e.x0 && d.edits[n-1].y1 == e.y0 {
+		d.edits[n-1].x1, d.edits[n-1].y1 = e.x1, e.y1
+		return
+	}
+	d.edits = append(d.edits, e)
+}
+
+// split returns a point (xm, ym) on a shortest path of edits from (x0, y0) to (x1, y1) that divides the edits of the
+// path approximately in half. The first lines and the last lines of x[x0:x1] and y[y0:y1] must differ. Returns false if
+// no point is found within diffCostLimit edits.
+//
+// The search proceeds forwards from (x0, y0) and backwards from (x1, y1) at the same time until the paths overlap.
+// vf[k+off] is the furthest x reached by a forward path on the diagonal k = x - y relative to (x0, y0) and vb[k+off]
+// is the furthest distance from x1 reached by a backward path on the diagonal k of the reversed lines. Paths that leave
+// the ranges are excluded from the search by trimming the diagonals that are searched.
+func (d *differ) split(x0, x1, y0, y1 int) (int, int, bool) {
+	n, m := x1-x0, y1-y0
+	maxD := (n + m + 1) / 2
+	off := maxD + 1
+	vf, vb := make([]int, 2*off+1), make([]int, 2*off+1)
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[off+1], vb[off+1] = 0, 0
+	delta := n - m
+	// if the difference in length is odd, the paths first overlap while extending the forward path
+	front := delta%2 != 0
+	var fStart, fEnd, bStart, bEnd int
+	for e := 0; e < maxD && e <= diffCostLimit; e++ {
+		for k := -e + fStart; k <= e-fEnd; k += 2 {
+			var x int
+			if k == -e || k != e && vf[k-1+off] < vf[k+1+off] {
+				x = vf[k+1+off]
+			} else {
+				x = vf[k-1+off] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.x[x0+x] == d.y[y0+y] {
+				x, y = x+1, y+1
+			}
+			vf[k+off] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case front:
+				if kb := delta - k + off; kb >= 0 && kb < len(vb) && vb[kb] != -1 && x >= n-vb[kb] {
+					return x0 + x, y0 + y, true
+				}
+			}
+		}
+		for k := -e + bStart; k <= e-bEnd; k += 2 {
+			var x int
+			if k == -e || k != e && vb[k-1+off] < vb[k+1+off] {
+				x = vb[k+1+off]
+			} else {
+				x = vb[k-1+off] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.x[x1-x-1] == d.y[y1-y-1] {
+				x, y = x+1, y+1
+			}
+			vb[k+off] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !front:
+				if kf := delta - k + off; kf >= 0 && kf < len(vf) && vf[kf] != -1 {
+					xf := vf[kf]
+					if yf := xf - (kf - off); xf >= n-x {
+						return x0 + xf, y0 + yf, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,171 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amalgomated
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffLinesReturnsShortestEdits(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randomLines := func() [][]byte {
+		lines := make([][]byte, r.Intn(12))
+		for i := range lines {
+			lines[i] = []byte{byte('a' + r.Intn(3)), '\n'}
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		x, y := randomLines(), randomLines()
+		edits := diffLines(x, y)
+		assert.Equal(t, string(bytes.Join(y, nil)), string(applyEdits(x, y, edits)), "Case %d: %q -> %q", i, x, y)
+		changed := 0
+		for j, e := range edits {
+			require.True(t, e.x0 <= e.x1 && e.y0 <= e.y1 && (e.x0 < e.x1 || e.y0 < e.y1), "Case %d: edit %d %+v is empty", i, j, e)
+			if j > 0 {
+				prev := edits[j-1]
+				require.True(t, prev.x1 < e.x0 || prev.y1 < e.y0, "Case %d: edit %d %+v is not separated from %+v", i, j, e, prev)
+			}
+			changed += e.x1 - e.x0 + e.y1 - e.y0
+		}
+		assert.Equal(t, len(x)+len(y)-2*lcsLength(x, y), changed, "Case %d: %q -> %q", i, x, y)
+	}
+}
+
+func TestDiffLinesLargeFiles(t *testing.T) {
+	const n = 20000
+	var lf, crlf, shifted bytes.Buffer
+	for i := 0; i < n; i++ {
+		line := strings.Repeat("x", i%80)
+		lf.WriteString(line + "\n")
+		crlf.WriteString(line + "\r\n")
+		if i%100 != 0 {
+			shifted.WriteString(line + "\n")
+		}
+	}
+
+	// every line changes: the lines are replaced as a whole
+	x, y := splitLines(crlf.Bytes()), splitLines(lf.Bytes())
+	assert.Equal(t, []edit{{0, n, 0, n}}, diffLines(x, y))
+
+	// every 100th line is removed
+	x, y = splitLines(lf.Bytes()), splitLines(shifted.Bytes())
+	edits := diffLines(x, y)
+	assert.Equal(t, shifted.String(), string(applyEdits(x, y, edits)))
+	removed := 0
+	for _, e := range edits {
+		removed += e.x1 - e.x0 - (e.y1 - e.y0)
+	}
+	assert.Equal(t, n/100, removed)
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	for i, tc := range []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{
+			name: "equal content has no diff",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+		},
+		{
+			name:    "changed line",
+			a:       "a\nb\nc\nd\n",
+			b:       "a\nB\nc\nd\n",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name:    "separate hunks",
+			a:       "1\n2\n3\n4\n5\n6\n7\n",
+			b:       "x\n2\n3\n4\n5\n6\ny\n",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -6,2 +6,2 @@\n 6\n-7\n+y\n",
+		},
+		{
+			name:    "nearby changes share a hunk",
+			a:       "1\n2\n3\n4\n5\n",
+			b:       "x\n2\n3\ny\n5\n",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,5 +1,5 @@\n-1\n+x\n 2\n 3\n-4\n+y\n 5\n",
+		},
+		{
+			name:    "content added to empty file",
+			a:       "",
+			b:       "x\n",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -0,0 +1 @@\n+x\n",
+		},
+		{
+			name:    "lines removed at end",
+			a:       "a\nb\nc\n",
+			b:       "a\n",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -1,3 +1 @@\n a\n-b\n-c\n",
+		},
+		{
+			name:    "missing newline at end of file",
+			a:       "a\nb",
+			b:       "a\nc",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+	} {
+		got := UnifiedDiff("old", "new", []byte(tc.a), []byte(tc.b), tc.context)
+		assert.Equal(t, tc.want, string(got), "Case %d: %s", i, tc.name)
+	}
+}
+
+func TestTruncateDiff(t *testing.T) {
+	d := UnifiedDiff("old", "new", []byte("1\n2\n3\n4\n5\n6\n7\n"), []byte("x\n2\n3\n4\n5\n6\ny\n"), 1)
+
+	got, omitted := TruncateDiff(d, 1)
+	assert.Equal(t, "--- old\n+++ new\n@@ -1,2 +1,2 @@\n-1\n+x\n 2\n", string(got))
+	assert.Equal(t, 1, omitted)
+
+	got, omitted = TruncateDiff(d, 2)
+	assert.Equal(t, string(d), string(got))
+	assert.Equal(t, 0, omitted)
+}
+
+// lcsLength returns the length of the longest common subsequence of x and y.
+func lcsLength(x, y [][]byte) int {
+	lengths := make([][]int, len(x)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			switch {
+			case bytes.Equal(x[i], y[j]):
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			case lengths[i+1][j] > lengths[i][j+1]:
+				lengths[i][j] = lengths[i+1][j]
+			default:
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	return lengths[0][0]
+}
@@ -28,6 +28,10 @@ The flags are:
 		to standard output.
 	-r rule
 		Apply the rewrite rule to the source before reformatting.
+	-report format=path
+		After processing all files, write a report of the results in
+		the given format (json, sarif, junit, checkstyle or github) to
+		path, or to standard output if path is "-". May be repeated.
 	-s
 		Try to simplify code (after applying the rewrite rule, if any).
 	-w
@@ -50,6 +54,20 @@ In the pattern, single-character lowercase identifiers serve as
 wildcards matching arbitrary sub-expressions; those expressions
 will be substituted for the same identifiers in the replacement.
 
+Alternatively, pattern and replacement may both be lists of Go statements
+separated by semicolons. A statement pattern matches any contiguous run of
+statements in a block or clause. A statement consisting only of a wildcard
+matches a single statement, and a statement consisting only of a wildcard
+followed by an underscore (such as s_) matches a possibly empty list of
+statements. Comments attached to the matched statements are kept before
+the replacement.
+
+Formatting of a region of a file can be suppressed with directives. The
+lines between a //gofmt:off comment and the next //gofmt:on comment, or
+the end of the file, are left byte-identical to the original source while
+the rest of the file is formatted and rewritten. Directives are ignored in
+program fragments.
+
 When gofmt reads from standard input, it accepts either a full Go program
 or a program fragment.  A program fragment must be a syntactically
 valid declaration list, statement list, or expression.  When formatting
@@ -71,6 +89,10 @@ To convert the package tree from explicit slice upper bounds to implicit ones:
 
 	gofmt -r 'α[β:len(α)] -> α[β:]' -w $GOROOT/src
 
+To replace loops that append each element of a slice with a single append:
+
+	gofmt -r 'for _, v := range y { x = append(x, v) } -> x = append(x, y...)' -w *.go
+
 The simplify command
 
 When invoked with -s gofmt will make the following source transformations where possible.
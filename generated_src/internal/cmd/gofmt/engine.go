@@ -0,0 +1,253 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amalgomated
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// Options configures the formatting performed by Source and File.
+type Options struct {
+	// Simplify applies the simplifications performed by "gofmt -s".
+	Simplify bool
+	// Simplifications are the names of the simplifications, which are returned by Simplifications and
+	// ExtraSimplifications, that are applied if Simplify is true. If nil, all of the simplifications performed by
+	// "gofmt -s", which are returned by Simplifications, are applied and none of the extra simplifications are applied.
+	Simplifications []string
+	// RewriteRules are applied to each file in order before it is formatted.
+	RewriteRules []RewriteRule
+	// AllErrors reports all parse errors rather than only the first 10 on different lines.
+	AllErrors bool
+	// SkipGenerated leaves generated files unchanged. A file is generated if a comment of the form
+	// "// Code generated ... DO NOT EDIT." precedes its package clause.
+	SkipGenerated bool
+	// Formatted, if non-nil, is called with the content of every file before it is parsed. If it returns true, the
+	// content is known to be formatted and is not parsed.
+	Formatted func(src []byte) bool `json:"-"`
+	// Lines, if non-nil, is called with the name of every file. If it returns true, only the changes made by formatting
+	// that overlap the returned line ranges of the file are applied and all other lines of the file are left unchanged.
+	// A file for which the returned ranges are empty is not changed.
+	Lines func(filename string) ([]LineRange, bool) `json:"-"`
+	// ForFile, if non-nil, is called with the name of every file and returns the options that are used to format the
+	// file in place of these options.
+	ForFile func(filename string) Options `json:"-"`
+}
+
+func (o Options) parserMode() parser.Mode {
+	mode := parser.ParseComments
+	if o.AllErrors {
+		mode |= parser.AllErrors
+	}
+	return mode
+}
+
+// cliOptions returns the Options specified by the command-line flags.
+func cliOptions() Options {
+	return Options{
+		Simplify:     *simplifyAST,
+		AllErrors:    *allErrors,
+		RewriteRules: rewriteRules,
+	}
+}
+
+// Result is the result of formatting a single file.
+type Result struct {
+	// Filename is the name of the file that was formatted.
+	Filename string
+	// Src is the original content of the file.
+	Src []byte
+	// Formatted is the formatted content of the file. Nil if Err is non-nil.
+	Formatted []byte
+	// Err is the error that occurred while reading or formatting the file, if any.
+	Err error
+	// RewriteRules are the names of the rewrite rules whose patterns matched the file, in the order in which the
+	// rules were applied.
+	RewriteRules []string
+	// Simplifications are the names of the simplifications that changed the file, in the order in which they are
+	// returned by Simplifications followed by the order in which they are returned by ExtraSimplifications.
+	Simplifications []string
+	// Cached is true if the file was not parsed because Options.Formatted reported its content as formatted.
+	Cached bool
+	// Generated is true if the file is generated.
+	Generated bool
+	// Skipped is true if the file was not formatted because it is generated and Options.SkipGenerated is true. The
+	// formatted content of a skipped file is its original content.
+	Skipped bool
+
+	perm os.FileMode
+	// output is the output of the gofmt command for the file.
+	output []byte
+}
+
+// ReportHandler is called by the gofmt command with the values of the -report flags and the results for the files that
+// were processed in the order in which they were specified. The -report flag is rejected if ReportHandler is nil.
+var ReportHandler func(reports []string, results []Result) error
+
+// Changed returns true if formatting succeeded and the formatted content differs from the original content.
+func (r Result) Changed() bool {
+	return r.Err == nil && !bytes.Equal(r.Src, r.Formatted)
+}
+
+// Diff returns the unified diff between the original and formatted content of the file with the given number of context
+// lines. The header names the original content "<Filename>.orig". Returns nil if the content has not changed.
+func (r Result) Diff(context int) []byte {
+	if !r.Changed() {
+		return nil
+	}
+	return diff(r.Src, r.Formatted, r.Filename, context)
+}
+
+// Write writes the formatted content back to the file if it has changed. The original file is backed up before it is
+// overwritten and restored if the write fails.
+func (r Result) Write() error {
+	if !r.Changed() {
+		return nil
+	}
+	return writeFile(r.Filename, r.Src, r.Formatted, r.perm)
+}
+
+// Source formats src, which was read from the named file. The returned Result is not associated with a file on disk
+// and writing it creates the file with mode 0644.
+func Source(filename string, src []byte, opts Options) Result {
+	if opts.ForFile != nil {
+		opts = opts.ForFile(filename)
+	}
+	// the header of the file is only parsed on its own if the file may not be formatted: otherwise, whether the file is
+	// generated is determined from the file parsed for formatting.
+	if opts.SkipGenerated && isGenerated(src) {
+		return Result{
+			Filename:  filename,
+			Src:       src,
+			Formatted: src,
+			Generated: true,
+			Skipped:   true,
+			perm:      0644,
+		}
+	}
+	if opts.Formatted != nil && opts.Formatted(src) {
+		// the file is not parsed for formatting, so its header is parsed unless it is already known not to be generated
+		return Result{
+			Filename:  filename,
+			Src:       src,
+			Formatted: src,
+			Cached:    true,
+			Generated: !opts.SkipGenerated && isGenerated(src),
+			perm:      0644,
+		}
+	}
+	res, info, err := formatSource(token.NewFileSet(), filename, src, false, opts)
+	if err == nil && opts.Lines != nil {
+		if ranges, ok := opts.Lines(filename); ok {
+			res, err = restrictToLines(filename, src, res, ranges, opts)
+		}
+	}
+	return Result{
+		Filename:        filename,
+		Src:             src,
+		Formatted:       res,
+		Err:             err,
+		RewriteRules:    info.rewriteRules,
+		Simplifications: info.simplifications,
+		Generated:       info.generated,
+		perm:            0644,
+	}
+}
+
+// File reads and formats the named file.
+func File(filename string, opts Options) Result {
+	src, perm, err := readFile(filename)
+	if err != nil {
+		return Result{
+			Filename: filename,
+			Err:      err,
+		}
+	}
+	result := Source(filename, src, opts)
+	result.perm = perm
+	return result
+}
+
+// Files formats the named files using up to concurrency goroutines and calls fn with the result for each file. fn is
+// called from the calling goroutine in the order in which the files were provided regardless of the order in which
+// formatting completes. If concurrency is less than 1, the value of runtime.GOMAXPROCS(0) is used.
+func Files(filenames []string, opts Options, concurrency int, fn func(Result)) {
+	forEachOrdered(len(filenames), concurrency, func(i int) Result {
+		return File(filenames[i], opts)
+	}, fn)
+}
+
+// Sources formats the content returned by read for each of the named files using up to concurrency goroutines and calls
+// fn with the result for each file in the order in which the files were provided. read is called concurrently. If
+// concurrency is less than 1, the value of runtime.GOMAXPROCS(0) is used.
+func Sources(filenames []string, read func(filename string) ([]byte, error), opts Options, concurrency int, fn func(Result)) {
+	forEachOrdered(len(filenames), concurrency, func(i int) Result {
+		src, err := read(filenames[i])
+		if err != nil {
+			return Result{
+				Filename: filenames[i],
+				Err:      err,
+			}
+		}
+		return Source(filenames[i], src, opts)
+	}, fn)
+}
+
+// forEachOrdered calls process for the indexes in [0, n) using up to concurrency goroutines and calls fn with the
+// returned results in index order from the calling goroutine. At most concurrency results are processed or waiting to
+// be passed to fn at any time, so a slow fn or a slow file holds back processing rather than results accumulating.
+func forEachOrdered(n, concurrency int, process func(i int) Result, fn func(Result)) {
+	if concurrency < 1 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	if concurrency > n {
+		concurrency = n
+	}
+
+	results := make([]chan Result, n)
+	for i := range results {
+		results[i] = make(chan Result, 1)
+	}
+	indexes := make(chan int)
+	// pending has a slot for every index that has been sent to the workers but whose result has not been passed to fn
+	pending := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] <- process(i)
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < n; i++ {
+			pending <- struct{}{}
+			indexes <- i
+		}
+		close(indexes)
+	}()
+
+	for _, result := range results {
+		fn(<-result)
+		<-pending
+	}
+	wg.Wait()
+}
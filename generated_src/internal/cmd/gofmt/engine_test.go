@@ -0,0 +1,49 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amalgomated
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEachOrderedLimitsResultsAhead(t *testing.T) {
+	const n, concurrency = 50, 4
+	var processed, consumed, maxAhead int64
+	var order []string
+	forEachOrdered(n, concurrency, func(i int) Result {
+		ahead := atomic.AddInt64(&processed, 1) - atomic.LoadInt64(&consumed)
+		for {
+			prev := atomic.LoadInt64(&maxAhead)
+			if ahead <= prev || atomic.CompareAndSwapInt64(&maxAhead, prev, ahead) {
+				break
+			}
+		}
+		return Result{Filename: string(rune('a' + i))}
+	}, func(result Result) {
+		time.Sleep(time.Millisecond)
+		order = append(order, result.Filename)
+		atomic.AddInt64(&consumed, 1)
+	})
+
+	assert.Len(t, order, n)
+	for i, filename := range order {
+		assert.Equal(t, string(rune('a'+i)), filename, "Case %d", i)
+	}
+	assert.True(t, maxAhead <= concurrency, "%d results were processed ahead of fn", maxAhead)
+}
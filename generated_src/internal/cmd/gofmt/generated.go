@@ -0,0 +1,52 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amalgomated
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+)
+
+// generatedRegexp matches the comment that marks a file as generated. See https://golang.org/s/generatedcode.
+var generatedRegexp = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether src is a generated Go source file. Only the package clause and the comments that precede
+// it are parsed. Source that cannot be parsed is not considered generated.
+func isGenerated(src []byte) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return false
+	}
+	return hasGeneratedComment(f)
+}
+
+// hasGeneratedComment reports whether f is a generated Go source file: that is, whether a line comment of the form
+// "// Code generated ... DO NOT EDIT." appears before the package clause. f must have been parsed with
+// parser.ParseComments.
+func hasGeneratedComment(f *ast.File) bool {
+	for _, group := range f.Comments {
+		if group.Pos() >= f.Package {
+			break
+		}
+		for _, c := range group.List {
+			if generatedRegexp.MatchString(c.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -9,14 +9,12 @@ import (
 	"github.com/palantir/godel-format-asset-gofmt/generated_src/internal/cmd/gofmt/amalgomated_flag"
 	"fmt"
 	"go/ast"
-	"go/parser"
 	"go/printer"
 	"go/scanner"
 	"go/token"
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
@@ -34,8 +32,27 @@ var (
 
 	// debugging
 	cpuprofile	= flag.String("cpuprofile", "", "write cpu profile to this file")
+
+	// reports
+	reportSpecs	stringList
 )
 
+func init() {
+	flag.Var(&reportSpecs, "report", "write a report of the form format=path after processing files (may be repeated)")
+}
+
+// stringList is a flag value that accumulates the values of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
 const (
 	tabWidth	= 8
 	printerMode	= printer.UseSpaces | printer.TabIndent
@@ -44,8 +61,7 @@ const (
 var (
 	fileSet		= token.NewFileSet()	// per process FileSet
 	exitCode	= 0
-	rewrite		func(*ast.File) *ast.File
-	parserMode	parser.Mode
+	rewriteRules	[]RewriteRule
 )
 
 func report(err error) {
@@ -58,13 +74,6 @@ func usage() {
 	flag.PrintDefaults()
 }
 
-func initParserMode() {
-	parserMode = parser.ParseComments
-	if *allErrors {
-		parserMode |= parser.AllErrors
-	}
-}
-
 func isGoFile(f os.FileInfo) bool {
 	// ignore non-Go files
 	name := f.Name()
@@ -72,52 +81,26 @@ func isGoFile(f os.FileInfo) bool {
 }
 
 // If in == nil, the source is the contents of the file with the given filename.
-func processFile(filename string, in io.Reader, out io.Writer, stdin bool) error {
-	var perm os.FileMode = 0644
+// The returned Result describes how the file was formatted; its Err field is set
+// if the file could not be processed.
+func processFile(filename string, in io.Reader, out io.Writer, stdin bool) Result {
+	result := Result{Filename: filename, perm: 0644}
 	if in == nil {
-		f, err := os.Open(filename)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		fi, err := f.Stat()
-		if err != nil {
-			return err
-		}
-		in = f
-		perm = fi.Mode().Perm()
+		result.Src, result.perm, result.Err = readFile(filename)
+	} else {
+		result.Src, result.Err = ioutil.ReadAll(in)
 	}
-
-	src, err := ioutil.ReadAll(in)
-	if err != nil {
-		return err
+	if result.Err != nil {
+		return result
 	}
+	src := result.Src
 
-	file, sourceAdj, indentAdj, err := parse(fileSet, filename, src, stdin)
+	res, info, err := formatSource(fileSet, filename, src, stdin, cliOptions())
 	if err != nil {
-		return err
-	}
-
-	if rewrite != nil {
-		if sourceAdj == nil {
-			file = rewrite(file)
-		} else {
-			fmt.Fprintf(os.Stderr, "warning: rewrite ignored for incomplete programs\n")
-		}
-	}
-
-	ast.SortImports(fileSet, file)
-
-	if *simplifyAST {
-		simplify(file)
-	}
-
-	ast.Inspect(file, normalizeNumbers)
-
-	res, err := format(fileSet, file, sourceAdj, indentAdj, src, printer.Config{Mode: printerMode, Tabwidth: tabWidth})
-	if err != nil {
-		return err
+		result.Err = err
+		return result
 	}
+	result.Formatted, result.RewriteRules, result.Simplifications = res, info.rewriteRules, info.simplifications
 
 	if !bytes.Equal(src, res) {
 		// formatting has changed
@@ -125,52 +108,112 @@ func processFile(filename string, in io.Reader, out io.Writer, stdin bool) error
 			fmt.Fprintln(out, filename)
 		}
 		if *write {
-			// make a temporary backup before overwriting original
-			bakname, err := backupFile(filename+".", src, perm)
-			if err != nil {
-				return err
-			}
-			err = ioutil.WriteFile(filename, res, perm)
-			if err != nil {
-				os.Rename(bakname, filename)
-				return err
-			}
-			err = os.Remove(bakname)
-			if err != nil {
-				return err
+			if err := writeFile(filename, src, res, result.perm); err != nil {
+				result.Err = err
+				return result
 			}
 		}
 		if *doDiff {
-			data, err := diff(src, res, filename)
-			if err != nil {
-				return fmt.Errorf("computing diff: %s", err)
-			}
-			fmt.Printf("diff -u %s %s\n", filepath.ToSlash(filename+".orig"), filepath.ToSlash(filename))
-			out.Write(data)
+			fmt.Fprintf(out, "diff -u %s %s\n", filepath.ToSlash(filename+".orig"), filepath.ToSlash(filename))
+			out.Write(diff(src, res, filename, DefaultDiffContext))
 		}
 	}
 
 	if !*list && !*write && !*doDiff {
-		_, err = out.Write(res)
+		_, result.Err = out.Write(res)
 	}
 
-	return err
+	return result
 }
 
-func visitFile(path string, f os.FileInfo, err error) error {
-	if err == nil && isGoFile(f) {
-		err = processFile(path, nil, os.Stdout, false)
+// readFile returns the contents and permissions of the named file.
+func readFile(filename string) ([]byte, os.FileMode, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, err
 	}
-	// Don't complain if a file was deleted in the meantime (i.e.
-	// the directory changed concurrently while running gofmt).
-	if err != nil && !os.IsNotExist(err) {
-		report(err)
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
 	}
-	return nil
+	src, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	return src, fi.Mode().Perm(), nil
+}
+
+// writeFile replaces the contents of the named file, which currently has the contents src, with res.
+func writeFile(filename string, src, res []byte, perm os.FileMode) error {
+	// make a temporary backup before overwriting original
+	bakname, err := backupFile(filename+".", src, perm)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filename, res, perm)
+	if err != nil {
+		os.Rename(bakname, filename)
+		return err
+	}
+	return os.Remove(bakname)
 }
 
-func walkDir(path string) {
-	filepath.Walk(path, visitFile)
+// applied records the transformations that formatSource applied to a file.
+type applied struct {
+	// rewriteRules are the names of the rewrite rules whose patterns matched.
+	rewriteRules	[]string
+	// simplifications are the names of the simplifications that changed the file.
+	simplifications	[]string
+	// generated is true if the file is generated.
+	generated	bool
+}
+
+// formatSource parses src, which was read from the named file, applies the transformations specified by opts and
+// returns the formatted source along with a record of the transformations that were applied.
+func formatSource(fset *token.FileSet, filename string, src []byte, fragmentOk bool, opts Options) ([]byte, applied, error) {
+	var info applied
+	file, sourceAdj, indentAdj, err := parse(fset, filename, src, fragmentOk, opts.parserMode())
+	if err != nil {
+		return nil, info, err
+	}
+	info.generated = hasGeneratedComment(file)
+
+	if len(opts.RewriteRules) > 0 {
+		if sourceAdj == nil {
+			file, info.rewriteRules = applyRewriteRules(fset, opts.RewriteRules, file)
+		} else {
+			fmt.Fprintf(os.Stderr, "warning: rewrite ignored for incomplete programs\n")
+		}
+	}
+
+	ast.SortImports(fset, file)
+
+	if opts.Simplify {
+		info.simplifications = simplify(fset, file, opts.Simplifications)
+	}
+
+	ast.Inspect(file, normalizeNumbers)
+
+	res, err := format(fset, file, sourceAdj, indentAdj, src, printer.Config{Mode: printerMode, Tabwidth: tabWidth})
+	return res, info, err
+}
+
+// goFiles returns the Go files in the directory tree rooted at path in lexical order.
+func goFiles(path string) []string {
+	var files []string
+	filepath.Walk(path, func(path string, f os.FileInfo, err error) error {
+		if err == nil && isGoFile(f) {
+			files = append(files, path)
+		}
+		// Don't complain if a file was deleted in the meantime (i.e.
+		// the directory changed concurrently while running gofmt).
+		if err != nil && !os.IsNotExist(err) {
+			report(err)
+		}
+		return nil
+	})
+	return files
 }
 
 func AmalgomatedMain() {
@@ -197,7 +240,6 @@ func gofmtMain() {
 		defer pprof.StopCPUProfile()
 	}
 
-	initParserMode()
 	initRewrite()
 
 	if flag.NArg() == 0 {
@@ -206,97 +248,77 @@ func gofmtMain() {
 			exitCode = 2
 			return
 		}
-		if err := processFile("<standard input>", os.Stdin, os.Stdout, true); err != nil {
-			report(err)
+		result := processFile("<standard input>", os.Stdin, os.Stdout, true)
+		if result.Err != nil {
+			report(result.Err)
 		}
+		writeReports([]Result{result})
 		return
 	}
 
+	// files and directories are expanded up front so that files can be processed in parallel while the output is
+	// still written in the order in which the files were specified.
+	var files []string
+	walked := make(map[string]bool)
 	for i := 0; i < flag.NArg(); i++ {
 		path := flag.Arg(i)
 		switch dir, err := os.Stat(path); {
 		case err != nil:
 			report(err)
 		case dir.IsDir():
-			walkDir(path)
-		default:
-			if err := processFile(path, nil, os.Stdout, false); err != nil {
-				report(err)
+			for _, file := range goFiles(path) {
+				files = append(files, file)
+				walked[file] = true
 			}
+		default:
+			files = append(files, path)
 		}
 	}
-}
 
-func writeTempFile(dir, prefix string, data []byte) (string, error) {
-	file, err := ioutil.TempFile(dir, prefix)
-	if err != nil {
-		return "", err
-	}
-	_, err = file.Write(data)
-	if err1 := file.Close(); err == nil {
-		err = err1
-	}
-	if err != nil {
-		os.Remove(file.Name())
-		return "", err
-	}
-	return file.Name(), nil
+	var results []Result
+	forEachOrdered(len(files), 0, func(i int) Result {
+		var out bytes.Buffer
+		result := processFile(files[i], nil, &out, false)
+		result.output = out.Bytes()
+		return result
+	}, func(result Result) {
+		os.Stdout.Write(result.output)
+		// Don't complain if a walked file was deleted in the meantime.
+		if result.Err != nil && walked[result.Filename] && os.IsNotExist(result.Err) {
+			return
+		}
+		if result.Err != nil {
+			report(result.Err)
+		}
+		if len(reportSpecs) > 0 {
+			result.output = nil
+			results = append(results, result)
+		}
+	})
+	writeReports(results)
 }
 
-func diff(b1, b2 []byte, filename string) (data []byte, err error) {
-	f1, err := writeTempFile("", "gofmt", b1)
-	if err != nil {
+// writeReports writes the reports specified by the -report flags for the provided results.
+func writeReports(results []Result) {
+	if len(reportSpecs) == 0 {
 		return
 	}
-	defer os.Remove(f1)
-
-	f2, err := writeTempFile("", "gofmt", b2)
-	if err != nil {
+	if ReportHandler == nil {
+		fmt.Fprintln(os.Stderr, "error: -report is not supported")
+		exitCode = 2
 		return
 	}
-	defer os.Remove(f2)
-
-	cmd := "diff"
-	if runtime.GOOS == "plan9" {
-		cmd = "/bin/ape/diff"
-	}
-
-	data, err = exec.Command(cmd, "-u", f1, f2).CombinedOutput()
-	if len(data) > 0 {
-		// diff exits with a non-zero status when the files don't match.
-		// Ignore that failure as long as we get output.
-		return replaceTempFilename(data, filename)
+	if err := ReportHandler(reportSpecs, results); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		exitCode = 2
 	}
-	return
 }
 
-// replaceTempFilename replaces temporary filenames in diff with actual one.
-//
-// --- /tmp/gofmt316145376	2017-02-03 19:13:00.280468375 -0500
-// +++ /tmp/gofmt617882815	2017-02-03 19:13:00.280468375 -0500
-// ...
-// ->
-// --- path/to/file.go.orig	2017-02-03 19:13:00.280468375 -0500
-// +++ path/to/file.go	2017-02-03 19:13:00.280468375 -0500
-// ...
-func replaceTempFilename(diff []byte, filename string) ([]byte, error) {
-	bs := bytes.SplitN(diff, []byte{'\n'}, 3)
-	if len(bs) < 3 {
-		return nil, fmt.Errorf("got unexpected diff for %s", filename)
-	}
-	// Preserve timestamps.
-	var t0, t1 []byte
-	if i := bytes.LastIndexByte(bs[0], '\t'); i != -1 {
-		t0 = bs[0][i:]
-	}
-	if i := bytes.LastIndexByte(bs[1], '\t'); i != -1 {
-		t1 = bs[1][i:]
-	}
-	// Always print filepath with slash separator.
+// diff returns the unified diff between the original content b1 and the formatted content b2 of filename. The file
+// names in the header always use the slash separator.
+func diff(b1, b2 []byte, filename string, context int) []byte {
 	f := filepath.ToSlash(filename)
-	bs[0] = []byte(fmt.Sprintf("--- %s%s", f+".orig", t0))
-	bs[1] = []byte(fmt.Sprintf("+++ %s%s", f, t1))
-	return bytes.Join(bs, []byte{'\n'}), nil
+	return UnifiedDiff(f+".orig", f, b1, b2, context)
 }
 
 const chmodSupported = runtime.GOOS != "windows"
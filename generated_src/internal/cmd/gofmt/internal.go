@@ -20,7 +20,7 @@ import (
 
 // parse parses src, which was read from the named file,
 // as a Go source file, declaration, or statement list.
-func parse(fset *token.FileSet, filename string, src []byte, fragmentOk bool) (
+func parse(fset *token.FileSet, filename string, src []byte, fragmentOk bool, parserMode parser.Mode) (
 	file *ast.File,
 	sourceAdj func(src []byte, indent int) []byte,
 	indentAdj int,
@@ -106,7 +106,8 @@ func format(
 		if err != nil {
 			return nil, err
 		}
-		return buf.Bytes(), nil
+		// Restore the regions suppressed by //gofmt:off directives.
+		return spliceSuppressed(src, buf.Bytes())
 	}
 
 	// Partial source file.
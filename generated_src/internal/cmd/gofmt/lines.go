@@ -0,0 +1,157 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amalgomated
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// LineRange is a range of lines in a file. Lines are numbered from 1 and both Start and End are inclusive.
+type LineRange struct {
+	Start, End int
+}
+
+func (r LineRange) String() string {
+	if r.Start == r.End {
+		return fmt.Sprintf("%d", r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// overlaps reports whether the edit overlaps any of the line ranges. An edit that only adds lines overlaps the ranges
+// that contain the line before or after the insertion point.
+func (e edit) overlaps(ranges []LineRange) bool {
+	// 1-based lines affected by the edit
+	start, end := e.x0+1, e.x1
+	if start > end {
+		start, end = e.x0, e.x0+1
+	}
+	for _, r := range ranges {
+		if r.Start <= end && start <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictToLines returns src with only the changes made by formatting it to res that overlap the provided line ranges
+// of src applied. Lines outside of the changes are identical to src.
+//
+// Applying only some of the changes can separate related changes, such as the removal and re-insertion of an import
+// that is sorted, so the result is verified by formatting it again: if it does not format to res, the changes are
+// extended to all changes within the top-level declarations that they touch. If the result still does not format to
+// res, an error is returned.
+func restrictToLines(filename string, src, res []byte, ranges []LineRange, opts Options) ([]byte, error) {
+	if bytes.Equal(src, res) {
+		return res, nil
+	}
+	x, y := splitLines(src), splitLines(res)
+	edits := diffLines(x, y)
+
+	selected := selectEdits(edits, ranges)
+	if len(selected) == 0 {
+		return src, nil
+	}
+	restricted := applyEdits(x, y, selected)
+	if formatsTo(filename, restricted, res, opts) {
+		return restricted, nil
+	}
+
+	declRanges, err := declLineRanges(filename, src, opts)
+	if err != nil {
+		return nil, err
+	}
+	var extended []LineRange
+	for _, r := range declRanges {
+		for _, e := range selected {
+			if e.overlaps([]LineRange{r}) {
+				extended = append(extended, r)
+				break
+			}
+		}
+	}
+	restricted = applyEdits(x, y, selectEdits(edits, append(extended, ranges...)))
+	if formatsTo(filename, restricted, res, opts) {
+		return restricted, nil
+	}
+	return nil, fmt.Errorf("formatting lines %v requires changes to other lines", ranges)
+}
+
+// selectEdits returns the edits that overlap the provided line ranges.
+func selectEdits(edits []edit, ranges []LineRange) []edit {
+	var selected []edit
+	for _, e := range edits {
+		if e.overlaps(ranges) {
+			selected = append(selected, e)
+		}
+	}
+	return selected
+}
+
+// applyEdits applies the provided edits, which transform lines of x into lines of y, to x.
+func applyEdits(x, y [][]byte, edits []edit) []byte {
+	var buf bytes.Buffer
+	i := 0
+	for _, e := range edits {
+		for ; i < e.x0; i++ {
+			buf.Write(x[i])
+		}
+		for j := e.y0; j < e.y1; j++ {
+			buf.Write(y[j])
+		}
+		i = e.x1
+	}
+	for ; i < len(x); i++ {
+		buf.Write(x[i])
+	}
+	return buf.Bytes()
+}
+
+// formatsTo reports whether src formats to res.
+func formatsTo(filename string, src, res []byte, opts Options) bool {
+	formatted, _, err := formatSource(token.NewFileSet(), filename, src, false, opts)
+	return err == nil && bytes.Equal(formatted, res)
+}
+
+// declLineRanges returns the line ranges of the top-level declarations in src, including their doc comments.
+func declLineRanges(filename string, src []byte, opts Options) ([]LineRange, error) {
+	fset := token.NewFileSet()
+	file, _, _, err := parse(fset, filename, src, false, opts.parserMode())
+	if err != nil {
+		return nil, err
+	}
+	var ranges []LineRange
+	for _, decl := range file.Decls {
+		start := decl.Pos()
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+		case *ast.GenDecl:
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+		}
+		ranges = append(ranges, LineRange{
+			Start: fset.Position(start).Line,
+			End:   fset.Position(decl.End()).Line,
+		})
+	}
+	return ranges, nil
+}
@@ -18,30 +18,101 @@ import (
 
 func initRewrite() {
 	if *rewriteRule == "" {
-		rewrite = nil	// disable any previous rewrite
+		rewriteRules = nil	// disable any previous rewrite
 		return
 	}
-	f := strings.Split(*rewriteRule, "->")
-	if len(f) != 2 {
-		fmt.Fprintf(os.Stderr, "rewrite rule must be of the form 'pattern -> replacement'\n")
+	rule, err := ParseRewriteRule("", *rewriteRule)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(2)
 	}
-	pattern := parseExpr(f[0], "pattern")
-	replace := parseExpr(f[1], "replacement")
-	rewrite = func(p *ast.File) *ast.File { return rewriteFile(pattern, replace, p) }
+	rewriteRules = []RewriteRule{rule}
+}
+
+// RewriteRule is a parsed rewrite rule of the form 'pattern -> replacement'.
+type RewriteRule struct {
+	// Name identifies the rule in results and errors.
+	Name	string
+	// Rule is the text of the rule.
+	Rule	string
+
+	// pattern and replace are set for expression rules.
+	pattern, replace	ast.Expr
+	// patternStmts and replaceStmts are set for statement rules.
+	patternStmts, replaceStmts	[]ast.Stmt
+}
+
+// ParseRewriteRule parses a rewrite rule of the form 'pattern -> replacement'.
+// If name is empty, the text of the rule is used as its name. If the pattern
+// is not an expression, the pattern and replacement are parsed as statement
+// lists (see rewrite_stmt.go).
+func ParseRewriteRule(name, rule string) (RewriteRule, error) {
+	if name == "" {
+		name = rule
+	}
+	f := strings.Split(rule, "->")
+	if len(f) != 2 {
+		return RewriteRule{}, fmt.Errorf("rewrite rule %q must be of the form 'pattern -> replacement'", name)
+	}
+	pattern, err := parseExpr(f[0], "pattern")
+	if err != nil {
+		patternStmts, stmtErr := parseStmts(f[0], "pattern")
+		if stmtErr != nil || len(patternStmts) == 0 {
+			// report the expression error since expression patterns are the common case
+			return RewriteRule{}, fmt.Errorf("rewrite rule %q: %v", name, err)
+		}
+		replaceStmts, err := parseStmts(f[1], "replacement")
+		if err != nil {
+			return RewriteRule{}, fmt.Errorf("rewrite rule %q: %v", name, err)
+		}
+		return RewriteRule{
+			Name:		name,
+			Rule:		rule,
+			patternStmts:	patternStmts,
+			replaceStmts:	replaceStmts,
+		}, nil
+	}
+	replace, err := parseExpr(f[1], "replacement")
+	if err != nil {
+		return RewriteRule{}, fmt.Errorf("rewrite rule %q: %v", name, err)
+	}
+	return RewriteRule{
+		Name:		name,
+		Rule:		rule,
+		pattern:	pattern,
+		replace:	replace,
+	}, nil
+}
+
+// apply applies the rule to an entire file and reports whether the pattern matched.
+func (r RewriteRule) apply(fset *token.FileSet, p *ast.File) (*ast.File, bool) {
+	if r.patternStmts != nil {
+		return rewriteFileStmts(fset, r.patternStmts, r.replaceStmts, p)
+	}
+	return rewriteFile(fset, r.pattern, r.replace, p)
+}
+
+// applyRewriteRules applies the rules to an entire file in order and returns
+// the names of the rules whose patterns matched.
+func applyRewriteRules(fset *token.FileSet, rules []RewriteRule, p *ast.File) (*ast.File, []string) {
+	var matched []string
+	for _, rule := range rules {
+		var ok bool
+		if p, ok = rule.apply(fset, p); ok {
+			matched = append(matched, rule.Name)
+		}
+	}
+	return p, matched
 }
 
 // parseExpr parses s as an expression.
-// It might make sense to expand this to allow statement patterns,
-// but there are problems with preserving formatting and also
-// with what a wildcard for a statement looks like.
-func parseExpr(s, what string) ast.Expr {
+// Statement patterns are parsed separately by parseStmts.
+func parseExpr(s, what string) (ast.Expr, error) {
 	x, err := parser.ParseExpr(s)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "parsing %s %s at %s\n", what, s, err)
-		os.Exit(2)
+		return nil, fmt.Errorf("parsing %s %s at %s", what, s, err)
 	}
-	return x
+	return x, nil
 }
 
 // Keep this function for debugging.
@@ -53,12 +124,14 @@ func dump(msg string, val reflect.Value) {
 }
 */
 
-// rewriteFile applies the rewrite rule 'pattern -> replace' to an entire file.
-func rewriteFile(pattern, replace ast.Expr, p *ast.File) *ast.File {
-	cmap := ast.NewCommentMap(fileSet, p, p.Comments)
+// rewriteFile applies the rewrite rule 'pattern -> replace' to an entire file
+// and reports whether the pattern matched anywhere in the file.
+func rewriteFile(fset *token.FileSet, pattern, replace ast.Expr, p *ast.File) (*ast.File, bool) {
+	cmap := ast.NewCommentMap(fset, p, p.Comments)
 	m := make(map[string]reflect.Value)
 	pat := reflect.ValueOf(pattern)
 	repl := reflect.ValueOf(replace)
+	matched := false
 
 	var rewriteVal func(val reflect.Value) reflect.Value
 	rewriteVal = func(val reflect.Value) reflect.Value {
@@ -71,6 +144,7 @@ func rewriteFile(pattern, replace ast.Expr, p *ast.File) *ast.File {
 			delete(m, k)
 		}
 		if match(m, pat, val) {
+			matched = true
 			val = subst(m, repl, reflect.ValueOf(val.Interface().(ast.Node).Pos()))
 		}
 		return val
@@ -78,7 +152,7 @@ func rewriteFile(pattern, replace ast.Expr, p *ast.File) *ast.File {
 
 	r := apply(rewriteVal, reflect.ValueOf(p)).Interface().(*ast.File)
 	r.Comments = cmap.Filter(r).Comments()	// recreate comments list
-	return r
+	return r, matched
 }
 
 // set is a wrapper for x.Set(y); it protects the caller from panics if x cannot be changed to y.
@@ -109,6 +183,8 @@ var (
 	objectPtrType	= reflect.TypeOf((*ast.Object)(nil))
 	positionType	= reflect.TypeOf(token.NoPos)
 	callExprType	= reflect.TypeOf((*ast.CallExpr)(nil))
+	exprStmtType	= reflect.TypeOf((*ast.ExprStmt)(nil))
+	stmtListType	= reflect.TypeOf([]ast.Stmt(nil))
 	scopePtrType	= reflect.TypeOf((*ast.Scope)(nil))
 )
 
@@ -175,6 +251,19 @@ func match(m map[string]reflect.Value, pattern, val reflect.Value) bool {
 		}
 	}
 
+	// A statement consisting only of a wildcard matches any statement.
+	if m != nil && pattern.IsValid() && pattern.Type() == exprStmtType {
+		if name, ok := stmtWildcard(pattern.Interface().(*ast.ExprStmt)); ok && val.IsValid() {
+			if _, ok := val.Interface().(ast.Stmt); ok && !val.IsNil() {
+				if old, ok := m[name]; ok {
+					return match(nil, old, val)
+				}
+				m[name] = val
+				return true
+			}
+		}
+	}
+
 	// Otherwise, pattern and val must match recursively.
 	if !pattern.IsValid() || !val.IsValid() {
 		return !pattern.IsValid() && !val.IsValid()
@@ -183,6 +272,11 @@ func match(m map[string]reflect.Value, pattern, val reflect.Value) bool {
 		return false
 	}
 
+	// Statement lists may contain list wildcards.
+	if pattern.Type() == stmtListType {
+		return matchStmts(m, pattern.Interface().([]ast.Stmt), val.Interface().([]ast.Stmt))
+	}
+
 	// Special cases.
 	switch pattern.Type() {
 	case identType:
@@ -255,11 +349,33 @@ func subst(m map[string]reflect.Value, pattern reflect.Value, pos reflect.Value)
 		name := pattern.Interface().(*ast.Ident).Name
 		if isWildcard(name) {
 			if old, ok := m[name]; ok {
-				return subst(nil, old, reflect.Value{})
+				if stmt, ok := old.Interface().(*ast.ExprStmt); ok {
+					// statement wildcard used as an expression
+					old = reflect.ValueOf(stmt.X)
+				}
+				if _, ok := old.Interface().(ast.Expr); ok {
+					return subst(nil, old, reflect.Value{})
+				}
 			}
 		}
 	}
 
+	// Statement wildcard gets replaced with the matched statement.
+	if m != nil && pattern.Type() == exprStmtType {
+		if name, ok := stmtWildcard(pattern.Interface().(*ast.ExprStmt)); ok {
+			if old, ok := m[name]; ok {
+				if _, ok := old.Interface().(ast.Stmt); ok {
+					return subst(nil, old, reflect.Value{})
+				}
+			}
+		}
+	}
+
+	// List wildcards in statement lists get replaced with the matched lists.
+	if m != nil && pattern.Type() == stmtListType {
+		return reflect.ValueOf(substStmts(m, pattern.Interface().([]ast.Stmt), pos))
+	}
+
 	if pos.IsValid() && pattern.Type() == positionType {
 		// use new position only if old position was valid in the first place
 		if old := pattern.Interface().(token.Pos); !old.IsValid() {
@@ -0,0 +1,373 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amalgomated
+
+// Statement rewrite rules.
+//
+// A rewrite rule whose pattern is not an expression is parsed as a pair of
+// statement lists. The pattern matches any contiguous run of statements in a
+// block, case clause or select clause. In addition to the expression
+// wildcards supported by expression rules:
+//
+//   - a statement consisting only of a wildcard (such as "s") matches exactly
+//     one statement;
+//   - a statement consisting only of a wildcard followed by an underscore
+//     (such as "s_") matches a possibly empty list of statements.
+//
+// When a pattern contains list wildcards and several runs starting at the
+// same statement match, the shortest run is replaced. Comments attached to
+// the matched statements are attached to the replacement. Statements bound to
+// wildcards retain their positions, so a replacement that reorders them may be
+// printed with blank lines between them.
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// parseStmts parses s as a list of statements.
+func parseStmts(s, what string) ([]ast.Stmt, error) {
+	const prefix = "package p; func _() {\n"
+	f, err := parser.ParseFile(token.NewFileSet(), "", prefix+s+"\n}", 0)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s %s as statements at %s", what, s, err)
+	}
+	// drop the *ast.Objects resolved by the parser: declarations in the
+	// statements introduce cycles that subst cannot copy
+	clearObjects(f)
+	list := f.Decls[0].(*ast.FuncDecl).Body.List
+	if list == nil {
+		// distinguish an empty statement list from an expression rule
+		list = []ast.Stmt{}
+	}
+	return list, nil
+}
+
+// clearObjects sets all *ast.Objects and *ast.Scopes in the tree rooted at
+// node to nil.
+func clearObjects(node ast.Node) {
+	var clear func(val reflect.Value) reflect.Value
+	clear = func(val reflect.Value) reflect.Value {
+		return apply(clear, val)
+	}
+	clear(reflect.ValueOf(node))
+}
+
+// stmtWildcard returns the name of the wildcard if s is a statement that
+// consists only of a wildcard.
+func stmtWildcard(s *ast.ExprStmt) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	ident, ok := s.X.(*ast.Ident)
+	if !ok || !isWildcard(ident.Name) {
+		return "", false
+	}
+	return ident.Name, true
+}
+
+// listWildcard returns the name of the list wildcard if s is a statement that
+// consists only of a list wildcard.
+func listWildcard(s ast.Stmt) (string, bool) {
+	stmt, ok := s.(*ast.ExprStmt)
+	if !ok {
+		return "", false
+	}
+	ident, ok := stmt.X.(*ast.Ident)
+	if !ok || !isListWildcard(ident.Name) {
+		return "", false
+	}
+	return ident.Name, true
+}
+
+func isListWildcard(s string) bool {
+	rune, size := utf8.DecodeRuneInString(s)
+	return size+1 == len(s) && unicode.IsLower(rune) && s[size] == '_'
+}
+
+// matchStmts reports whether the statement list pattern matches the entire
+// statement list vals, recording wildcard submatches in m. If m == nil,
+// matchStmts checks whether pattern == vals.
+func matchStmts(m map[string]reflect.Value, pattern, vals []ast.Stmt) bool {
+	if m == nil {
+		if len(pattern) != len(vals) {
+			return false
+		}
+		for i := range pattern {
+			if !match(nil, reflect.ValueOf(pattern[i]), reflect.ValueOf(vals[i])) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if len(pattern) == 0 {
+		return len(vals) == 0
+	}
+
+	if name, ok := listWildcard(pattern[0]); ok {
+		if old, ok := m[name]; ok {
+			// a list wildcard that appears multiple times must match the same list each time
+			oldList := old.Interface().([]ast.Stmt)
+			if len(oldList) > len(vals) || !matchStmts(nil, oldList, vals[:len(oldList)]) {
+				return false
+			}
+			return matchStmts(m, pattern[1:], vals[len(oldList):])
+		}
+		for n := 0; n <= len(vals); n++ {
+			saved := copyMatches(m)
+			m[name] = reflect.ValueOf(vals[:n:n])
+			if matchStmts(m, pattern[1:], vals[n:]) {
+				return true
+			}
+			restoreMatches(m, saved)
+		}
+		return false
+	}
+
+	if len(vals) == 0 {
+		return false
+	}
+	saved := copyMatches(m)
+	if match(m, reflect.ValueOf(pattern[0]), reflect.ValueOf(vals[0])) && matchStmts(m, pattern[1:], vals[1:]) {
+		return true
+	}
+	restoreMatches(m, saved)
+	return false
+}
+
+func copyMatches(m map[string]reflect.Value) map[string]reflect.Value {
+	c := make(map[string]reflect.Value, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func restoreMatches(m, saved map[string]reflect.Value) {
+	for k := range m {
+		delete(m, k)
+	}
+	for k, v := range saved {
+		m[k] = v
+	}
+}
+
+// substStmts returns a copy of the statement list pattern with values from m
+// substituted in place of wildcards and list wildcards. Expressions bound to
+// wildcards are positioned at pos along with the tokens from the pattern so
+// that the printer does not break lines within the replacement; statements
+// bound to wildcards retain their positions.
+func substStmts(m map[string]reflect.Value, pattern []ast.Stmt, pos reflect.Value) []ast.Stmt {
+	for name, val := range m {
+		if _, ok := val.Interface().(ast.Expr); ok {
+			m[name] = subst(nil, val, pos)
+		}
+	}
+	list := make([]ast.Stmt, 0, len(pattern))
+	for _, stmt := range pattern {
+		if name, ok := listWildcard(stmt); ok {
+			if old, ok := m[name]; ok {
+				list = append(list, subst(nil, old, reflect.Value{}).Interface().([]ast.Stmt)...)
+				continue
+			}
+		}
+		list = append(list, subst(m, reflect.ValueOf(stmt), pos).Interface().(ast.Stmt))
+	}
+	return list
+}
+
+// rewriteFileStmts applies the statement rewrite rule 'pattern -> replace' to
+// an entire file and reports whether the pattern matched anywhere in the file.
+func rewriteFileStmts(fset *token.FileSet, pattern, replace []ast.Stmt, p *ast.File) (*ast.File, bool) {
+	cmap := ast.NewCommentMap(fset, p, p.Comments)
+
+	// like rewriteFile, drop *ast.Objects and *ast.Scopes: they introduce
+	// cycles and are likely incorrect after a rewrite
+	clearObjects(p)
+
+	// collect the statement lists in the file: lists are collected before the
+	// lists nested in them, so rewriting them in reverse order rewrites inner
+	// statements first
+	var lists []*[]ast.Stmt
+	var owners []ast.Node
+	ast.Inspect(p, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			lists, owners = append(lists, &n.List), append(owners, n)
+		case *ast.CaseClause:
+			lists, owners = append(lists, &n.Body), append(owners, n)
+		case *ast.CommClause:
+			lists, owners = append(lists, &n.Body), append(owners, n)
+		}
+		return true
+	})
+
+	matched := false
+	for i := len(lists) - 1; i >= 0; i-- {
+		if rewriteStmtList(fset, cmap, pattern, replace, lists[i], owners[i]) {
+			matched = true
+		}
+	}
+	if matched {
+		p.Comments = cmap.Filter(p).Comments()	// recreate comments list
+	}
+	return p, matched
+}
+
+// rewriteStmtList replaces every run of statements in *list that matches
+// pattern with the corresponding substitution of replace and reports whether
+// any run matched. Comments associated with the replaced statements are
+// associated with the first replacement statement or, if the replacement is
+// empty, with owner.
+func rewriteStmtList(fset *token.FileSet, cmap ast.CommentMap, pattern, replace []ast.Stmt, list *[]ast.Stmt, owner ast.Node) bool {
+	matched := false
+	vals := *list
+	for i := 0; i < len(vals); i++ {
+		for j := i; j <= len(vals); j++ {
+			if j == i && len(pattern) > 0 {
+				// non-empty patterns never match an empty run
+				continue
+			}
+			m := make(map[string]reflect.Value)
+			run := vals[i:j:j]
+			if !matchStmts(m, pattern, run) {
+				continue
+			}
+			if len(run) == 0 {
+				// patterns that match an empty run would be applied indefinitely
+				break
+			}
+			matched = true
+			repl := substStmts(m, replace, reflect.ValueOf(run[0].Pos()))
+
+			var comments []*ast.CommentGroup
+			for _, stmt := range run {
+				for _, groups := range cmap.Filter(stmt) {
+					comments = append(comments, groups...)
+				}
+			}
+			sort.Slice(comments, func(i, j int) bool {
+				return comments[i].Pos() < comments[j].Pos()
+			})
+			comments = moveCommentsBefore(comments, run[0].Pos())
+			if len(comments) > 0 {
+				commentOwner := owner
+				if len(repl) > 0 {
+					commentOwner = repl[0]
+				}
+				cmap[commentOwner] = append(cmap[commentOwner], comments...)
+			}
+
+			collapseLines(fset, repl, run)
+
+			rest := append([]ast.Stmt(nil), vals[j:]...)
+			vals = append(append(vals[:i], repl...), rest...)
+			// continue after the replacement
+			i += len(repl) - 1
+			break
+		}
+	}
+	*list = vals
+	return matched
+}
+
+// moveCommentsBefore returns comments with the comments that are positioned
+// after pos merged into a single group positioned immediately before pos so
+// that the printer emits them before a replacement positioned at pos.
+func moveCommentsBefore(comments []*ast.CommentGroup, pos token.Pos) []*ast.CommentGroup {
+	var before []*ast.CommentGroup
+	moved := &ast.CommentGroup{}
+	for _, group := range comments {
+		if group.Pos() < pos {
+			before = append(before, group)
+			continue
+		}
+		for _, c := range group.List {
+			moved.List = append(moved.List, &ast.Comment{Slash: pos - 1, Text: c.Text})
+		}
+	}
+	if len(moved.List) == 0 {
+		return before
+	}
+	return append(before, moved)
+}
+
+// collapseLines removes the source lines that were occupied by run but are
+// not occupied by its replacement repl. Without this, the printer would
+// preserve the vertical space of run by inserting blank lines around the
+// replacement and between statements of run that are bound to wildcards,
+// which retain their positions. Blank lines between the statements of run are
+// preserved.
+func collapseLines(fset *token.FileSet, repl, run []ast.Stmt) {
+	file := fset.File(run[0].Pos())
+	if file == nil {
+		return
+	}
+	inFile := func(pos token.Pos) bool {
+		return pos.IsValid() && file.Base() <= int(pos) && int(pos) <= file.Base()+file.Size()
+	}
+	vacated := make(map[int]bool)
+	for _, stmt := range run {
+		for line := file.Line(stmt.Pos()); line <= file.Line(stmt.End()); line++ {
+			vacated[line] = true
+		}
+	}
+	// the lines spanned by each replacement statement are occupied; the
+	// tokens of the replacement that come from the pattern are positioned at
+	// the start of run
+	for _, stmt := range repl {
+		first, last := 0, 0
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if n == nil {
+				return false
+			}
+			for _, pos := range []token.Pos{n.Pos(), n.End()} {
+				if !inFile(pos) {
+					continue
+				}
+				line := file.Line(pos)
+				if first == 0 || line < first {
+					first = line
+				}
+				if line > last {
+					last = line
+				}
+			}
+			return true
+		})
+		for line := first; first > 0 && line <= last; line++ {
+			delete(vacated, line)
+		}
+	}
+	lines := make([]int, 0, len(vacated))
+	for line := range vacated {
+		lines = append(lines, line)
+	}
+	// remove the last lines first so that the numbers of the other lines
+	// remain valid
+	sort.Sort(sort.Reverse(sort.IntSlice(lines)))
+	for _, line := range lines {
+		if line > 1 {
+			file.MergeLine(line - 1)
+		}
+	}
+}
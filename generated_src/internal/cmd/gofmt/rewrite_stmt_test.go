@@ -0,0 +1,125 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amalgomated
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementRewriteRules(t *testing.T) {
+	for i, tc := range []struct {
+		name    string
+		rule    string
+		body    string
+		want    string
+		matched bool
+	}{
+		{
+			name:    "multi-statement pattern",
+			rule:    "a := b; use(a) -> use(b)",
+			body:    "\tx := compute()\n\tuse(x)\n\tdone()\n",
+			want:    "\tuse(compute())\n\tdone()\n",
+			matched: true,
+		},
+		{
+			name: "wildcard must bind the same expression in every statement",
+			rule: "a := b; use(a) -> use(b)",
+			body: "\tx := compute()\n\tuse(y)\n",
+			want: "\tx := compute()\n\tuse(y)\n",
+		},
+		{
+			name:    "statement wildcard matches exactly one statement",
+			rule:    "before(); s; after() -> s",
+			body:    "\tbefore()\n\tx()\n\tafter()\n\tbefore()\n\tx()\n\ty()\n\tafter()\n",
+			want:    "\tx()\n\tbefore()\n\tx()\n\ty()\n\tafter()\n",
+			matched: true,
+		},
+		{
+			name:    "list wildcard matches any number of statements",
+			rule:    "mu.Lock(); s_; mu.Unlock() -> mu.Lock(); defer mu.Unlock(); s_",
+			body:    "\tmu.Lock()\n\tx()\n\ty()\n\tmu.Unlock()\n",
+			want:    "\tmu.Lock()\n\tdefer mu.Unlock()\n\tx()\n\ty()\n",
+			matched: true,
+		},
+		{
+			name:    "list wildcard matches no statements",
+			rule:    "mu.Lock(); s_; mu.Unlock() -> mu.Lock(); defer mu.Unlock(); s_",
+			body:    "\tmu.Lock()\n\tmu.Unlock()\n",
+			want:    "\tmu.Lock()\n\tdefer mu.Unlock()\n",
+			matched: true,
+		},
+		{
+			name:    "blank lines between statements bound to a list wildcard are preserved",
+			rule:    "before(); s_; after() -> s_",
+			body:    "\tbefore()\n\tx()\n\n\ty()\n\tafter()\n\tz()\n",
+			want:    "\tx()\n\n\ty()\n\tz()\n",
+			matched: true,
+		},
+		{
+			name:    "list wildcard matches the shortest run",
+			rule:    "mu.Lock(); s_; mu.Unlock() -> mu.Lock(); defer mu.Unlock(); s_",
+			body:    "\tmu.Lock()\n\tx()\n\tmu.Unlock()\n\ty()\n\tmu.Unlock()\n",
+			want:    "\tmu.Lock()\n\tdefer mu.Unlock()\n\tx()\n\ty()\n\tmu.Unlock()\n",
+			matched: true,
+		},
+		{
+			name:    "list wildcard must bind the same statements each time",
+			rule:    "s_; s_ -> s_",
+			body:    "\tx()\n\ty()\n\tx()\n\ty()\n",
+			want:    "\tx()\n\ty()\n",
+			matched: true,
+		},
+		{
+			name: "pattern does not match across a nested block",
+			rule: "a := b; use(a) -> use(b)",
+			body: "\tx := compute()\n\tif ok {\n\t\tuse(x)\n\t}\n",
+			want: "\tx := compute()\n\tif ok {\n\t\tuse(x)\n\t}\n",
+		},
+		{
+			name: "pattern does not match across the end of a block",
+			rule: "a := b; use(a) -> use(b)",
+			body: "\t{\n\t\tx := compute()\n\t}\n\tuse(x)\n",
+			want: "\t{\n\t\tx := compute()\n\t}\n\tuse(x)\n",
+		},
+		{
+			name: "pattern does not match across case clauses",
+			rule: "a := b; use(a) -> use(b)",
+			body: "\tswitch {\n\tcase ok:\n\t\tx := compute()\n\tdefault:\n\t\tuse(x)\n\t}\n",
+			want: "\tswitch {\n\tcase ok:\n\t\tx := compute()\n\tdefault:\n\t\tuse(x)\n\t}\n",
+		},
+		{
+			name:    "pattern matches within nested blocks and clauses",
+			rule:    "a := b; use(a) -> use(b)",
+			body:    "\tif ok {\n\t\tx := compute()\n\t\tuse(x)\n\t}\n\tselect {\n\tcase <-c:\n\t\ty := compute()\n\t\tuse(y)\n\t}\n",
+			want:    "\tif ok {\n\t\tuse(compute())\n\t}\n\tselect {\n\tcase <-c:\n\t\tuse(compute())\n\t}\n",
+			matched: true,
+		},
+	} {
+		rule, err := ParseRewriteRule(tc.name, tc.rule)
+		require.NoError(t, err, "Case %d: %s", i, tc.name)
+		src := "package p\n\nfunc f() {\n" + tc.body + "}\n"
+		res := Source("p.go", []byte(src), Options{RewriteRules: []RewriteRule{rule}})
+		require.NoError(t, res.Err, "Case %d: %s", i, tc.name)
+		assert.Equal(t, "package p\n\nfunc f() {\n"+tc.want+"}\n", string(res.Formatted), "Case %d: %s", i, tc.name)
+		var wantRules []string
+		if tc.matched {
+			wantRules = []string{tc.name}
+		}
+		assert.Equal(t, wantRules, res.RewriteRules, "Case %d: %s", i, tc.name)
+	}
+}
@@ -10,7 +10,41 @@ import (
 	"reflect"
 )
 
-type simplifier struct{}
+// Names of the simplifications performed by simplify.
+const (
+	// []T{T{}} -> []T{{}}
+	simplifyCompositeLiteral	= "composite-literal"
+	// []*T{&T{}} -> []*T{{}}
+	simplifyCompositeLiteralAddress	= "composite-literal-address"
+	// s[a:len(s)] -> s[a:]
+	simplifySliceExpression	= "slice-expression"
+	// for x, _ = range v -> for x = range v; for _ = range v -> for range v
+	simplifyRange	= "range"
+	// const () -> (removed)
+	simplifyEmptyDeclGroup	= "empty-decl-group"
+)
+
+// simplifications are the names of the simplifications performed by "gofmt -s" in the order in which they are
+// reported.
+var simplifications = []string{
+	simplifyCompositeLiteral,
+	simplifyCompositeLiteralAddress,
+	simplifySliceExpression,
+	simplifyRange,
+	simplifyEmptyDeclGroup,
+}
+
+// Simplifications returns the names of the simplifications performed by "gofmt -s".
+func Simplifications() []string {
+	return append([]string(nil), simplifications...)
+}
+
+type simplifier struct {
+	// enabled records the names of the simplifications that are applied.
+	enabled	map[string]bool
+	// fired records the names of the simplifications that changed the file.
+	fired	map[string]bool
+}
 
 func (s simplifier) Visit(node ast.Node) ast.Visitor {
 	switch n := node.(type) {
@@ -57,10 +91,11 @@ func (s simplifier) Visit(node ast.Node) ast.Visitor {
 		//       file belonging to the same package. However, this is extremely unlikely
 		//       and so far (April 2016, after years of supporting this rewrite feature)
 		//       has never come up, so let's keep it working as is (see also #15153).
-		if n.Max != nil {
+		if n.Max != nil || !s.enabled[simplifySliceExpression] {
 			// - 3-index slices always require the 2nd and 3rd index
 			break
 		}
+		fired := s.fired
 		if s, _ := n.X.(*ast.Ident); s != nil && s.Obj != nil {
 			// the array/slice object is a single, resolved identifier
 			if call, _ := n.High.(*ast.CallExpr); call != nil && len(call.Args) == 1 && !call.Ellipsis.IsValid() {
@@ -71,6 +106,7 @@ func (s simplifier) Visit(node ast.Node) ast.Visitor {
 					if arg, _ := call.Args[0].(*ast.Ident); arg != nil && arg.Obj == s.Obj {
 						// the len argument is the array/slice object
 						n.High = nil
+						fired[simplifySliceExpression] = true
 					}
 				}
 			}
@@ -88,11 +124,16 @@ func (s simplifier) Visit(node ast.Node) ast.Visitor {
 		// can be simplified to: for x = range v {...}
 		// - a range of the form: for _ = range v {...}
 		// can be simplified to: for range v {...}
+		if !s.enabled[simplifyRange] {
+			break
+		}
 		if isBlank(n.Value) {
 			n.Value = nil
+			s.fired[simplifyRange] = true
 		}
 		if isBlank(n.Key) && n.Value == nil {
 			n.Key = nil
+			s.fired[simplifyRange] = true
 		}
 	}
 
@@ -105,20 +146,22 @@ func (s simplifier) simplifyLiteral(typ reflect.Value, astType, x ast.Expr, px *
 	// if the element is a composite literal and its literal type
 	// matches the outer literal's element type exactly, the inner
 	// literal type may be omitted
-	if inner, ok := x.(*ast.CompositeLit); ok {
+	if inner, ok := x.(*ast.CompositeLit); ok && s.enabled[simplifyCompositeLiteral] {
 		if match(nil, typ, reflect.ValueOf(inner.Type)) {
 			inner.Type = nil
+			s.fired[simplifyCompositeLiteral] = true
 		}
 	}
 	// if the outer literal's element type is a pointer type *T
 	// and the element is & of a composite literal of type T,
 	// the inner &T may be omitted.
-	if ptr, ok := astType.(*ast.StarExpr); ok {
+	if ptr, ok := astType.(*ast.StarExpr); ok && s.enabled[simplifyCompositeLiteralAddress] {
 		if addr, ok := x.(*ast.UnaryExpr); ok && addr.Op == token.AND {
 			if inner, ok := addr.X.(*ast.CompositeLit); ok {
 				if match(nil, reflect.ValueOf(ptr.X), reflect.ValueOf(inner.Type)) {
 					inner.Type = nil	// drop T
 					*px = inner		// drop &
+					s.fired[simplifyCompositeLiteralAddress] = true
 				}
 			}
 		}
@@ -130,15 +173,44 @@ func isBlank(x ast.Expr) bool {
 	return ok && ident.Name == "_"
 }
 
-func simplify(f *ast.File) {
+// simplify applies the named simplifications, including extra simplifications, to f and returns the names of the
+// simplifications that changed it. If names is nil, all of the simplifications performed by "gofmt -s" are applied.
+// Unknown names are ignored.
+func simplify(fset *token.FileSet, f *ast.File, names []string) []string {
+	if names == nil {
+		names = simplifications
+	}
+	s := simplifier{
+		enabled:	make(map[string]bool),
+		fired:		make(map[string]bool),
+	}
+	for _, name := range names {
+		s.enabled[name] = true
+	}
+
 	// remove empty declarations such as "const ()", etc
-	removeEmptyDeclGroups(f)
+	if s.enabled[simplifyEmptyDeclGroup] && removeEmptyDeclGroups(f) {
+		s.fired[simplifyEmptyDeclGroup] = true
+	}
 
-	var s simplifier
 	ast.Walk(s, f)
+
+	simplifyExtra(fset, f, s.enabled, s.fired)
+
+	var fired []string
+	for _, group := range [][]string{simplifications, extraSimplifications} {
+		for _, name := range group {
+			if s.fired[name] {
+				fired = append(fired, name)
+			}
+		}
+	}
+	return fired
 }
 
-func removeEmptyDeclGroups(f *ast.File) {
+// removeEmptyDeclGroups removes empty declaration groups from f and reports whether any were removed.
+func removeEmptyDeclGroups(f *ast.File) bool {
+	n := len(f.Decls)
 	i := 0
 	for _, d := range f.Decls {
 		if g, ok := d.(*ast.GenDecl); !ok || !isEmpty(f, g) {
@@ -147,6 +219,7 @@ func removeEmptyDeclGroups(f *ast.File) {
 		}
 	}
 	f.Decls = f.Decls[:i]
+	return i != n
 }
 
 func isEmpty(f *ast.File, g *ast.GenDecl) bool {
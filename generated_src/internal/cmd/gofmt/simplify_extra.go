@@ -0,0 +1,438 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amalgomated
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"sort"
+)
+
+// Names of the extra simplifications. Unlike the simplifications performed by "gofmt -s", the extra simplifications
+// are only applied if they are named explicitly. They are purely syntactic: the types of expressions are not known, so
+// each is only applied where the syntax alone guarantees that it does not change the meaning of a program, assuming
+// that the predeclared identifiers true and false are not redeclared. Comments associated with the nodes that are
+// removed are associated with the replacement.
+const (
+	// if a < b == true {...} -> if a < b {...}; for !x != true {...} -> for x {...}. Only applied to the conditions of if
+	// and for statements and only if the operand compared with the literal is syntactically boolean.
+	simplifyBoolLiteralComparison = "bool-literal-comparison"
+	// if a == b { return true }; return false -> return a == b. Only applied if the condition is an untyped boolean.
+	simplifyReturnBoolCondition = "return-bool-condition"
+	// return (x) -> return x
+	simplifyReturnParens = "return-parens"
+	// var x T = T(v) -> var x = T(v)
+	simplifyVarConversion = "var-conversion"
+	// switch { case c: f(); break } -> switch { case c: f() }
+	simplifyTrailingBreak = "trailing-break"
+	// if c { return x } else { f() } -> if c { return x }; f(). Not applied if the if statement has an initialization
+	// statement or if the else block declares any identifiers.
+	simplifyElseAfterReturn = "else-after-return"
+)
+
+// extraSimplifications are the names of the extra simplifications in the order in which they are reported.
+var extraSimplifications = []string{
+	simplifyBoolLiteralComparison,
+	simplifyReturnBoolCondition,
+	simplifyReturnParens,
+	simplifyVarConversion,
+	simplifyTrailingBreak,
+	simplifyElseAfterReturn,
+}
+
+// ExtraSimplifications returns the names of the extra simplifications, which are not performed by "gofmt -s" and are
+// only applied if they are named in Options.Simplifications.
+func ExtraSimplifications() []string {
+	return append([]string(nil), extraSimplifications...)
+}
+
+// extraSimplifier applies the enabled extra simplifications to a file and records the ones that changed it.
+type extraSimplifier struct {
+	fset    *token.FileSet
+	cmap    ast.CommentMap
+	enabled map[string]bool
+	fired   map[string]bool
+}
+
+// simplifyExtra applies the enabled extra simplifications to f and records the names of the ones that changed it in
+// fired.
+func simplifyExtra(fset *token.FileSet, f *ast.File, enabled, fired map[string]bool) {
+	anyEnabled := false
+	for _, name := range extraSimplifications {
+		anyEnabled = anyEnabled || enabled[name]
+	}
+	if !anyEnabled {
+		return
+	}
+	s := &extraSimplifier{
+		fset:    fset,
+		cmap:    ast.NewCommentMap(fset, f, f.Comments),
+		enabled: enabled,
+		fired:   make(map[string]bool),
+	}
+
+	// collect the statement lists in the file before changing them: like rewriteFileStmts, the lists are simplified in
+	// reverse order so that nested statements are simplified first
+	var lists []*[]ast.Stmt
+	var owners []ast.Node
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.IfStmt:
+			s.simplifyCondition(n, &n.Cond)
+		case *ast.ForStmt:
+			s.simplifyCondition(n, &n.Cond)
+		case *ast.ReturnStmt:
+			s.simplifyReturnParens(n)
+		case *ast.ValueSpec:
+			s.simplifyVarConversion(n)
+		case *ast.SwitchStmt:
+			s.simplifyTrailingBreaks(n.Body)
+		case *ast.TypeSwitchStmt:
+			s.simplifyTrailingBreaks(n.Body)
+		}
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			lists, owners = append(lists, &n.List), append(owners, n)
+		case *ast.CaseClause:
+			lists, owners = append(lists, &n.Body), append(owners, n)
+		case *ast.CommClause:
+			lists, owners = append(lists, &n.Body), append(owners, n)
+		}
+		return true
+	})
+	for i := len(lists) - 1; i >= 0; i-- {
+		s.simplifyStmtList(lists[i], owners[i])
+	}
+
+	if len(s.fired) > 0 {
+		f.Comments = s.cmap.Filter(f).Comments() // recreate comments list
+		for name := range s.fired {
+			fired[name] = true
+		}
+	}
+}
+
+// simplifyCondition simplifies the comparison of the condition *cond of stmt with a boolean literal.
+func (s *extraSimplifier) simplifyCondition(stmt ast.Stmt, cond *ast.Expr) {
+	if !s.enabled[simplifyBoolLiteralComparison] {
+		return
+	}
+	binary, ok := (*cond).(*ast.BinaryExpr)
+	if !ok || binary.Op != token.EQL && binary.Op != token.NEQ {
+		return
+	}
+	x, lit := binary.X, binary.Y
+	if !isBoolLiteral(lit) {
+		x, lit = lit, x
+	}
+	if !isBoolLiteral(lit) || !isBool(x) {
+		return
+	}
+	// x == true and x != false are x, x == false and x != true are !x
+	if (binary.Op == token.EQL) != (lit.(*ast.Ident).Name == "true") {
+		x = negate(x, binary.Pos())
+	}
+	s.moveComments(binary, x, stmt)
+	*cond = x
+	s.fired[simplifyBoolLiteralComparison] = true
+}
+
+// simplifyReturnParens removes the parentheses around the results of stmt.
+func (s *extraSimplifier) simplifyReturnParens(stmt *ast.ReturnStmt) {
+	if !s.enabled[simplifyReturnParens] {
+		return
+	}
+	for i, result := range stmt.Results {
+		paren, ok := result.(*ast.ParenExpr)
+		if !ok {
+			continue
+		}
+		x := paren.X
+		for inner, ok := x.(*ast.ParenExpr); ok; inner, ok = x.(*ast.ParenExpr) {
+			x = inner.X
+		}
+		s.moveComments(paren, x, stmt)
+		stmt.Results[i] = x
+		s.fired[simplifyReturnParens] = true
+	}
+}
+
+// simplifyVarConversion removes the type of spec if every value of spec is a conversion to that type.
+func (s *extraSimplifier) simplifyVarConversion(spec *ast.ValueSpec) {
+	if !s.enabled[simplifyVarConversion] || spec.Type == nil || len(spec.Values) == 0 {
+		return
+	}
+	for _, value := range spec.Values {
+		call, ok := value.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 || call.Ellipsis.IsValid() {
+			return
+		}
+		if !match(nil, reflect.ValueOf(spec.Type), reflect.ValueOf(call.Fun)) {
+			return
+		}
+	}
+	s.moveComments(spec.Type, nil, spec)
+	spec.Type = nil
+	s.fired[simplifyVarConversion] = true
+}
+
+// simplifyTrailingBreaks removes the unlabeled break statements at the end of the case clauses of the switch
+// statement with the provided body.
+func (s *extraSimplifier) simplifyTrailingBreaks(body *ast.BlockStmt) {
+	if !s.enabled[simplifyTrailingBreak] {
+		return
+	}
+	for _, stmt := range body.List {
+		clause, ok := stmt.(*ast.CaseClause)
+		if !ok || len(clause.Body) == 0 {
+			continue
+		}
+		last := len(clause.Body) - 1
+		if branch, ok := clause.Body[last].(*ast.BranchStmt); ok && branch.Tok == token.BREAK && branch.Label == nil {
+			s.replaceStmts(&clause.Body, last, last+1, nil, clause)
+			s.fired[simplifyTrailingBreak] = true
+		}
+	}
+}
+
+// simplifyStmtList applies the extra simplifications that replace runs of statements to *list.
+func (s *extraSimplifier) simplifyStmtList(list *[]ast.Stmt, owner ast.Node) {
+	for i := 0; i < len(*list); i++ {
+		if s.enabled[simplifyElseAfterReturn] && s.outdentElse(list, i) {
+			s.fired[simplifyElseAfterReturn] = true
+		}
+		if s.enabled[simplifyReturnBoolCondition] && s.returnCondition(list, i, owner) {
+			s.fired[simplifyReturnBoolCondition] = true
+		}
+	}
+}
+
+// outdentElse moves the statements of the else block of the if statement (*list)[i] into *list after the if statement
+// if the if block ends with a return statement and reports whether it did.
+func (s *extraSimplifier) outdentElse(list *[]ast.Stmt, i int) bool {
+	stmt, ok := (*list)[i].(*ast.IfStmt)
+	if !ok || stmt.Init != nil || len(stmt.Body.List) == 0 {
+		return false
+	}
+	if _, ok := stmt.Body.List[len(stmt.Body.List)-1].(*ast.ReturnStmt); !ok {
+		return false
+	}
+	block, ok := stmt.Else.(*ast.BlockStmt)
+	if !ok || declaresIdents(block.List) {
+		return false
+	}
+
+	var owner ast.Node = stmt
+	if len(block.List) > 0 {
+		owner = block.List[0]
+	}
+	s.moveComments(block, nil, owner)
+	stmt.Else = nil
+
+	// merge the source lines that were occupied by the closing brace of the else block so that the printer does not
+	// insert a blank line after the outdented statements
+	if file := s.fset.File(block.Pos()); file != nil {
+		lastLine := file.Line(stmt.Body.End())
+		if len(block.List) > 0 {
+			lastLine = file.Line(block.List[len(block.List)-1].End())
+		}
+		for line := file.Line(block.End()); line > lastLine; line-- {
+			file.MergeLine(lastLine)
+		}
+	}
+
+	rest := append([]ast.Stmt(nil), (*list)[i+1:]...)
+	*list = append(append((*list)[:i+1], block.List...), rest...)
+	return true
+}
+
+// returnCondition replaces the if statement (*list)[i] that returns a boolean literal and the return statement that
+// follows it and returns the opposite literal with a statement that returns the condition of the if statement and
+// reports whether it did.
+func (s *extraSimplifier) returnCondition(list *[]ast.Stmt, i int, owner ast.Node) bool {
+	if i+1 >= len(*list) {
+		return false
+	}
+	stmt, ok := (*list)[i].(*ast.IfStmt)
+	if !ok || stmt.Init != nil || stmt.Else != nil || len(stmt.Body.List) != 1 || !isUntypedBool(stmt.Cond) {
+		return false
+	}
+	thenLit, ok := returnedBoolLiteral(stmt.Body.List[0])
+	if !ok {
+		return false
+	}
+	elseLit, ok := returnedBoolLiteral((*list)[i+1])
+	if !ok || thenLit == elseLit {
+		return false
+	}
+
+	result := stmt.Cond
+	if thenLit == "false" {
+		result = negate(result, result.Pos())
+	}
+	repl := &ast.ReturnStmt{
+		Return:  stmt.Pos(),
+		Results: []ast.Expr{result},
+	}
+	s.replaceStmts(list, i, i+2, []ast.Stmt{repl}, owner)
+	return true
+}
+
+// replaceStmts replaces the statements (*list)[i:j] with repl. Like rewriteStmtList, the comments associated with the
+// replaced statements are associated with the first replacement statement or, if the replacement is empty, with
+// owner.
+func (s *extraSimplifier) replaceStmts(list *[]ast.Stmt, i, j int, repl []ast.Stmt, owner ast.Node) {
+	run := (*list)[i:j:j]
+
+	var comments []*ast.CommentGroup
+	for _, stmt := range run {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if n == nil {
+				return false
+			}
+			comments = append(comments, s.cmap[n]...)
+			delete(s.cmap, n)
+			return true
+		})
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].Pos() < comments[j].Pos()
+	})
+	comments = moveCommentsBefore(comments, run[0].Pos())
+	if len(comments) > 0 {
+		commentOwner := owner
+		if len(repl) > 0 {
+			commentOwner = repl[0]
+		}
+		s.cmap[commentOwner] = append(s.cmap[commentOwner], comments...)
+	}
+
+	collapseLines(s.fset, repl, run)
+
+	rest := append([]ast.Stmt(nil), (*list)[j:]...)
+	*list = append(append((*list)[:i], repl...), rest...)
+}
+
+// moveComments associates the comments that are associated with the nodes in the tree rooted at from, other than the
+// nodes in the tree rooted at keep, with to. keep may be nil.
+func (s *extraSimplifier) moveComments(from, keep, to ast.Node) {
+	kept := make(map[ast.Node]bool)
+	if keep != nil {
+		ast.Inspect(keep, func(n ast.Node) bool {
+			if n != nil {
+				kept[n] = true
+			}
+			return true
+		})
+	}
+	var comments []*ast.CommentGroup
+	ast.Inspect(from, func(n ast.Node) bool {
+		if n == nil || kept[n] {
+			return false
+		}
+		comments = append(comments, s.cmap[n]...)
+		delete(s.cmap, n)
+		return true
+	})
+	if len(comments) > 0 {
+		s.cmap[to] = append(s.cmap[to], comments...)
+	}
+}
+
+// isBoolLiteral returns true if x is one of the predeclared identifiers true and false. Identifiers that resolve to a
+// declaration in the file are not literals.
+func isBoolLiteral(x ast.Expr) bool {
+	ident, ok := x.(*ast.Ident)
+	return ok && ident.Obj == nil && (ident.Name == "true" || ident.Name == "false")
+}
+
+// returnedBoolLiteral returns the boolean literal returned by stmt if it is a return statement with a single boolean
+// literal result.
+func returnedBoolLiteral(stmt ast.Stmt) (string, bool) {
+	ret, ok := stmt.(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 || !isBoolLiteral(ret.Results[0]) {
+		return "", false
+	}
+	return ret.Results[0].(*ast.Ident).Name, true
+}
+
+// isBool returns true if x is syntactically a boolean value of some boolean type: a comparison or a logical operation.
+// Other expressions, such as identifiers, may have any type that can be compared with a boolean literal, such as
+// interface{}.
+func isBool(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return isBool(x.X)
+	case *ast.UnaryExpr:
+		return x.Op == token.NOT
+	case *ast.BinaryExpr:
+		switch x.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ, token.LAND, token.LOR:
+			return true
+		}
+	}
+	return false
+}
+
+// isUntypedBool returns true if x is syntactically an untyped boolean value: a comparison or a logical operation on
+// untyped boolean values. Untyped boolean values can be returned as any boolean type.
+func isUntypedBool(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return isUntypedBool(x.X)
+	case *ast.UnaryExpr:
+		return x.Op == token.NOT && isUntypedBool(x.X)
+	case *ast.BinaryExpr:
+		switch x.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return true
+		case token.LAND, token.LOR:
+			return isUntypedBool(x.X) && isUntypedBool(x.Y)
+		}
+	case *ast.Ident:
+		return isBoolLiteral(x)
+	}
+	return false
+}
+
+// negate returns the logical negation of x positioned at pos.
+func negate(x ast.Expr, pos token.Pos) ast.Expr {
+	switch e := x.(type) {
+	case *ast.UnaryExpr:
+		if e.Op == token.NOT {
+			return e.X
+		}
+	case *ast.Ident, *ast.SelectorExpr, *ast.CallExpr, *ast.IndexExpr, *ast.ParenExpr:
+	default:
+		x = &ast.ParenExpr{Lparen: pos, X: x, Rparen: x.End()}
+	}
+	return &ast.UnaryExpr{OpPos: pos, Op: token.NOT, X: x}
+}
+
+// declaresIdents returns true if any of the statements in list declares an identifier in the scope of list.
+func declaresIdents(list []ast.Stmt) bool {
+	for _, stmt := range list {
+		switch stmt := stmt.(type) {
+		case *ast.DeclStmt:
+			return true
+		case *ast.AssignStmt:
+			if stmt.Tok == token.DEFINE {
+				return true
+			}
+		}
+	}
+	return false
+}
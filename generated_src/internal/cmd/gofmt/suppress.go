@@ -0,0 +1,118 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amalgomated
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// Formatting directives. The lines that follow a "//gofmt:off" comment up to the line that contains the next
+// "//gofmt:on" comment, or the end of the file, are left byte-identical to the original source while the rest of the
+// file is formatted. The lines that contain the directives are formatted.
+const (
+	formatOffDirective = "//gofmt:off"
+	formatOnDirective  = "//gofmt:on"
+)
+
+// suppressedRegion is a range of byte offsets [start, end) of a file whose formatting is suppressed.
+type suppressedRegion struct {
+	start, end int
+}
+
+// suppressedRegions returns the regions of src whose formatting is suppressed by directives, in order. Directives
+// that do not start or end a region, such as a "//gofmt:off" comment within a region, are ignored.
+func suppressedRegions(src []byte) []suppressedRegion {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	// src has already been parsed, so errors are not expected and are ignored
+	s.Init(file, src, nil, scanner.ScanComments)
+
+	var regions []suppressedRegion
+	start := -1
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.COMMENT {
+			continue
+		}
+		offset := file.Offset(pos)
+		switch {
+		case start < 0 && isDirective(lit, formatOffDirective):
+			// the region starts on the line after the directive
+			start = len(src)
+			if i := bytes.IndexByte(src[offset:], '\n'); i >= 0 {
+				start = offset + i + 1
+			}
+		case start >= 0 && isDirective(lit, formatOnDirective):
+			// the region ends before the line of the directive
+			end := bytes.LastIndexByte(src[:offset], '\n') + 1
+			if end < start {
+				end = start
+			}
+			regions = append(regions, suppressedRegion{start: start, end: end})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		regions = append(regions, suppressedRegion{start: start, end: len(src)})
+	}
+	return regions
+}
+
+// isDirective reports whether the comment text is the directive, optionally followed by a space and an explanation.
+func isDirective(comment, directive string) bool {
+	return comment == directive || strings.HasPrefix(comment, directive+" ") || strings.HasPrefix(comment, directive+"\t")
+}
+
+// spliceSuppressed returns res, the formatted content of src, with the regions whose formatting is suppressed by
+// directives replaced by their content in src. Regions are matched by the order of their directives, which the
+// printer preserves. Returns an error if the directives in res do not match those in src or if the result does not
+// parse.
+func spliceSuppressed(src, res []byte) ([]byte, error) {
+	if !bytes.Contains(src, []byte(formatOffDirective)) {
+		return res, nil
+	}
+	srcRegions := suppressedRegions(src)
+	if len(srcRegions) == 0 {
+		return res, nil
+	}
+	resRegions := suppressedRegions(res)
+	if len(resRegions) != len(srcRegions) {
+		return nil, fmt.Errorf("%s directives were moved or removed by formatting", formatOffDirective)
+	}
+
+	var buf bytes.Buffer
+	last := 0
+	for i, r := range resRegions {
+		buf.Write(res[last:r.start])
+		buf.Write(src[srcRegions[i].start:srcRegions[i].end])
+		last = r.end
+	}
+	buf.Write(res[last:])
+	spliced := buf.Bytes()
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "", spliced, parser.ParseComments); err != nil {
+		return nil, fmt.Errorf("source suppressed by %s does not parse within the formatted file: %v", formatOffDirective, err)
+	}
+	return spliced, nil
+}
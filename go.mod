@@ -9,6 +9,7 @@ require (
 	github.com/palantir/godel/v2 v2.22.0
 	github.com/palantir/pkg v0.0.0-20191028175011-d684c9609178
 	github.com/pkg/errors v0.8.1
+	github.com/spf13/cobra v0.0.5
 	github.com/stretchr/testify v1.4.0
 	gopkg.in/yaml.v2 v2.2.5
 )
@@ -0,0 +1,205 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	amalgomatedformatter "github.com/palantir/godel-format-asset-gofmt/generated_src"
+)
+
+// BaselineVersion is the version of the format of baseline files.
+const BaselineVersion = 1
+
+// Baseline records the files that were not formatted when it was created along with the hashes of their content. A
+// file in the baseline is neither formatted nor listed as long as its content is unchanged.
+type Baseline struct {
+	// Files maps the path of each file relative to the project directory, using the slash separator, to the hex-encoded
+	// SHA-256 hash of its content.
+	Files map[string]string
+}
+
+// Contains returns true if the file with the provided path, relative to the project directory using the slash
+// separator, and content is in the baseline.
+func (b Baseline) Contains(path string, src []byte) bool {
+	hash, ok := b.Files[path]
+	return ok && hash == contentHash(src)
+}
+
+// contentHash returns the hash of the provided content that is recorded in baselines.
+func contentHash(src []byte) string {
+	sum := sha256.Sum256(src)
+	return hex.EncodeToString(sum[:])
+}
+
+// baselineFile is the JSON schema of baseline files. Files are written with sorted keys and one file per line so that
+// changes to a checked-in baseline are easy to review.
+type baselineFile struct {
+	Version int               `json:"version"`
+	Files   map[string]string `json:"files"`
+}
+
+// ReadBaseline reads the baseline file at path.
+func ReadBaseline(path string) (Baseline, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Baseline{}, errors.Errorf("baseline %s does not exist: create it with the baseline command", path)
+		}
+		return Baseline{}, errors.Wrapf(err, "failed to read baseline %s", path)
+	}
+	var file baselineFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return Baseline{}, errors.Wrapf(err, "failed to parse baseline %s", path)
+	}
+	if file.Version != BaselineVersion {
+		return Baseline{}, errors.Errorf("baseline %s has unsupported version %d: must be %d", path, file.Version, BaselineVersion)
+	}
+	return Baseline{
+		Files: file.Files,
+	}, nil
+}
+
+// WriteBaseline writes the baseline to the file at path.
+func WriteBaseline(path string, baseline Baseline) error {
+	file := baselineFile{
+		Version: BaselineVersion,
+		Files:   baseline.Files,
+	}
+	if file.Files == nil {
+		file.Files = map[string]string{}
+	}
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(file)
+	}); err != nil {
+		return errors.Wrapf(err, "failed to write baseline %s", path)
+	}
+	return nil
+}
+
+// baselinePath returns the absolute path of the baseline file of the Formatter.
+func (f *Formatter) baselinePath(projectDir string) (string, error) {
+	if filepath.IsAbs(f.Baseline) {
+		return f.Baseline, nil
+	}
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to determine absolute path of %q", projectDir)
+	}
+	return filepath.Join(dir, f.Baseline), nil
+}
+
+// projectBaseline is a baseline of the files in a project directory.
+type projectBaseline struct {
+	Baseline
+	// dir is the absolute path of the project directory.
+	dir string
+}
+
+// contains returns true if the provided result is for a file in the baseline that is changed by formatting.
+func (b *projectBaseline) contains(result amalgomatedformatter.Result) bool {
+	if !result.Changed() {
+		return false
+	}
+	absFile, err := filepath.Abs(result.Filename)
+	if err != nil {
+		return false
+	}
+	return b.Contains(reportPath(absFile, b.dir), result.Src)
+}
+
+// readBaseline returns the baseline of the Formatter, or nil if it has no baseline.
+func (f *Formatter) readBaseline(projectDir string) (*projectBaseline, error) {
+	if f.Baseline == "" {
+		return nil, nil
+	}
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to determine absolute path of %q", projectDir)
+	}
+	path, err := f.baselinePath(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := ReadBaseline(path)
+	if err != nil {
+		return nil, err
+	}
+	return &projectBaseline{
+		Baseline: baseline,
+		dir:      dir,
+	}, nil
+}
+
+// UpdateBaseline replaces the baseline file of the Formatter with a baseline that contains the provided files that are
+// not formatted. Files that are formatted, including files that were in the previous baseline, are not included. The
+// files are not modified, and ChangedSince, Staged and line ranges are ignored so that the baseline is complete.
+// Returns the number of files in the baseline. If any of the files cannot be formatted, the baseline is written and a
+// *FormatError is returned.
+func (f *Formatter) UpdateBaseline(files []string, projectDir string) (int, error) {
+	if f.Baseline == "" {
+		return 0, errors.Errorf("baseline path must be specified")
+	}
+	path, err := f.baselinePath(projectDir)
+	if err != nil {
+		return 0, err
+	}
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to determine absolute path of %q", projectDir)
+	}
+	settings, err := f.fileSettings(files, projectDir, nil)
+	if err != nil {
+		return 0, err
+	}
+	opts := amalgomatedformatter.Options{
+		ForFile: func(filename string) amalgomatedformatter.Options {
+			return settings[filename].opts
+		},
+	}
+	baseline := Baseline{
+		Files: make(map[string]string),
+	}
+	var fileErrs []FileError
+	amalgomatedformatter.FormatFiles(files, opts, f.Concurrency, func(result amalgomatedformatter.Result) {
+		if result.Err != nil {
+			fileErrs = append(fileErrs, newFileErrors(result.Filename, result.Err)...)
+			return
+		}
+		if !result.Changed() {
+			return
+		}
+		absFile, err := filepath.Abs(result.Filename)
+		if err != nil {
+			fileErrs = append(fileErrs, newFileErrors(result.Filename, err)...)
+			return
+		}
+		baseline.Files[reportPath(absFile, dir)] = contentHash(result.Src)
+	})
+	if err := WriteBaseline(path, baseline); err != nil {
+		return 0, err
+	}
+	return len(baseline.Files), formatErrorOrNil(fileErrs, false, nil)
+}
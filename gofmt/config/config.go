@@ -15,14 +15,171 @@
 package config
 
 import (
+	"path/filepath"
+	"regexp"
+
+	"github.com/palantir/pkg/matcher"
+	"github.com/pkg/errors"
+
 	"github.com/palantir/godel-format-asset-gofmt/gofmt"
-	v0 "github.com/palantir/godel-format-asset-gofmt/gofmt/config/internal/v0"
+	v1 "github.com/palantir/godel-format-asset-gofmt/gofmt/config/internal/v1"
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/internal/cache"
 )
 
-type Gofmt v0.Config
+type Gofmt v1.Config
 
-func (cfg *Gofmt) ToFormatter() *gofmt.Formatter {
+func (cfg *Gofmt) ToFormatter() (*gofmt.Formatter, error) {
+	if err := gofmt.ValidateSimplifyRules(cfg.SkipSimplifyRules); err != nil {
+		return nil, err
+	}
+	if err := gofmt.ValidateExtraSimplifyRules(cfg.ExtraSimplifyRules); err != nil {
+		return nil, err
+	}
+	ruleNames := make(map[string]struct{})
+	rewriteRules, err := parseRewriteRules(cfg.RewriteRules, ruleNames)
+	if err != nil {
+		return nil, err
+	}
+	var overrides []gofmt.Override
+	for i, overrideCfg := range cfg.Overrides {
+		override, err := toOverride(overrideCfg, ruleNames)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid override %d", i)
+		}
+		overrides = append(overrides, override)
+	}
+	var cacheDir string
+	if !cfg.SkipCache {
+		// if the default cache directory cannot be determined, run without a cache
+		cacheDir, _ = cache.DefaultDir()
+	}
+	var reports []gofmt.ReportOutput
+	for _, report := range cfg.Reports {
+		format, err := gofmt.ParseReportFormat(report.Format)
+		if err != nil {
+			return nil, err
+		}
+		if report.Path == "" {
+			return nil, errors.Errorf("path must be specified for %s report", format)
+		}
+		if format == gofmt.GitHubReportFormat && report.Path == gofmt.StdoutReportPath {
+			// the format plugin does not show the output of the formatter when verifying, so the commands would never
+			// take effect
+			return nil, errors.Errorf("%s report cannot be written to %q: write it to a file or use the -report flag of the gofmt command", format, report.Path)
+		}
+		reports = append(reports, gofmt.ReportOutput{
+			Format: format,
+			Path:   report.Path,
+		})
+	}
+	var lineRanges map[string][]gofmt.LineRange
+	for path, ranges := range cfg.LineRanges {
+		if lineRanges == nil {
+			lineRanges = make(map[string][]gofmt.LineRange)
+		}
+		for _, rangeStr := range ranges {
+			lineRange, err := gofmt.ParseLineRange(rangeStr)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid line ranges for %s", path)
+			}
+			lineRanges[path] = append(lineRanges[path], lineRange)
+		}
+	}
+	generated, err := gofmt.ParseGeneratedPolicy(cfg.Generated)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Verify.ShowDiff && cfg.Verify.OutputFile == "" {
+		// the format plugin only shows the names of files when verifying, so the diffs would never be shown
+		return nil, errors.Errorf("verify.show-diff requires verify.output-file")
+	}
+	diffContext := -1
+	if cfg.Verify.DiffContext != nil {
+		diffContext = *cfg.Verify.DiffContext
+	}
 	return &gofmt.Formatter{
-		SkipSimplify: cfg.SkipSimplify,
+		SkipSimplify:            cfg.SkipSimplify,
+		SkipSimplifyRules:       cfg.SkipSimplifyRules,
+		ExtraSimplifyRules:      cfg.ExtraSimplifyRules,
+		RewriteRules:            rewriteRules,
+		CacheDir:                cacheDir,
+		Concurrency:             cfg.Concurrency,
+		Diff:                    cfg.Verify.ShowDiff,
+		DiffContext:             diffContext,
+		MaxDiffHunks:            cfg.Verify.MaxHunks,
+		VerifyOutputFile:        cfg.Verify.OutputFile,
+		Reports:                 reports,
+		PatchFile:               cfg.PatchFile,
+		ChangedSince:            cfg.ChangedSince,
+		ChangedLinesOnly:        cfg.ChangedLinesOnly,
+		LineRanges:              lineRanges,
+		Generated:               generated,
+		Overrides:               overrides,
+		Baseline:                cfg.Baseline,
+		Staged:                  cfg.Staged,
+		StagedUpdateWorkingTree: cfg.StagedUpdateWorkingTree,
+		Subprocess:              cfg.Subprocess,
+	}, nil
+}
+
+// parseRewriteRules parses the provided rewrite rules. ruleNames contains the names of the rules that have already been
+// parsed, which the names of the provided rules are added to: rule names must be unique within the configuration.
+func parseRewriteRules(rules []v1.RewriteRule, ruleNames map[string]struct{}) ([]gofmt.RewriteRule, error) {
+	var rewriteRules []gofmt.RewriteRule
+	for _, rule := range rules {
+		parsed, err := gofmt.ParseRewriteRule(rule.Name, rule.Rule)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := ruleNames[parsed.Name]; ok {
+			return nil, errors.Errorf("rewrite rule %q is specified more than once", parsed.Name)
+		}
+		ruleNames[parsed.Name] = struct{}{}
+		rewriteRules = append(rewriteRules, parsed)
+	}
+	return rewriteRules, nil
+}
+
+// toOverride returns the override for the provided configuration.
+func toOverride(cfg v1.Override, ruleNames map[string]struct{}) (gofmt.Override, error) {
+	if cfg.Match.Empty() {
+		return gofmt.Override{}, errors.Errorf("match must specify names or paths")
+	}
+	for _, cfg := range []matcher.NamesPathsCfg{cfg.Match.NamesPathsCfg, cfg.Match.Exclude} {
+		// the matcher panics if expressions or patterns are invalid
+		for _, name := range cfg.Names {
+			if _, err := regexp.Compile(name); err != nil {
+				return gofmt.Override{}, errors.Wrapf(err, "invalid name expression %q", name)
+			}
+		}
+		for _, path := range cfg.Paths {
+			if _, err := filepath.Match(path, ""); err != nil {
+				return gofmt.Override{}, errors.Wrapf(err, "invalid path pattern %q", path)
+			}
+		}
+	}
+	if err := gofmt.ValidateSimplifyRules(cfg.SkipSimplifyRules); err != nil {
+		return gofmt.Override{}, err
+	}
+	if err := gofmt.ValidateExtraSimplifyRules(cfg.ExtraSimplifyRules); err != nil {
+		return gofmt.Override{}, err
+	}
+	rewriteRules, err := parseRewriteRules(cfg.RewriteRules, ruleNames)
+	if err != nil {
+		return gofmt.Override{}, err
+	}
+	var generated gofmt.GeneratedPolicy
+	if cfg.Generated != "" {
+		if generated, err = gofmt.ParseGeneratedPolicy(cfg.Generated); err != nil {
+			return gofmt.Override{}, err
+		}
 	}
+	return gofmt.Override{
+		Matcher:            cfg.Match.Matcher(),
+		SkipSimplify:       cfg.SkipSimplify,
+		SkipSimplifyRules:  cfg.SkipSimplifyRules,
+		ExtraSimplifyRules: cfg.ExtraSimplifyRules,
+		RewriteRules:       rewriteRules,
+		Generated:          generated,
+	}, nil
 }
@@ -0,0 +1,76 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/config"
+)
+
+func TestToFormatter(t *testing.T) {
+	for i, tc := range []struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{
+			name: "github report written to a file",
+			in: `version: 1
+reports:
+  - format: github
+    path: out/gofmt.txt
+`,
+		},
+		{
+			name: "github report cannot be written to the output of the formatter",
+			in: `version: 1
+reports:
+  - format: github
+    path: "-"
+`,
+			wantErr: `github report cannot be written to "-": write it to a file or use the -report flag of the gofmt command`,
+		},
+		{
+			name: "diffs written to the verify output file",
+			in: `version: 1
+verify:
+  show-diff: true
+  output-file: out/verify.txt
+`,
+		},
+		{
+			name: "diffs cannot be shown without a verify output file",
+			in: `version: 1
+verify:
+  show-diff: true
+`,
+			wantErr: "verify.show-diff requires verify.output-file",
+		},
+	} {
+		var cfg config.Gofmt
+		require.NoError(t, yaml.Unmarshal([]byte(tc.in), &cfg), "Case %d: %s", i, tc.name)
+		_, err := cfg.ToFormatter()
+		if tc.wantErr == "" {
+			assert.NoError(t, err, "Case %d: %s", i, tc.name)
+		} else {
+			assert.EqualError(t, err, tc.wantErr, "Case %d: %s", i, tc.name)
+		}
+	}
+}
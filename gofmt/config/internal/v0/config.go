@@ -15,12 +15,20 @@
 package v0
 
 import (
+	"github.com/palantir/godel/v2/pkg/versionedconfig"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
+
+	v1 "github.com/palantir/godel-format-asset-gofmt/gofmt/config/internal/v1"
 )
 
 type Config struct {
 	SkipSimplify bool `yaml:"skip-simplify,omitempty"`
+	// Concurrency is the maximum number of files that are formatted in parallel. If unspecified or less than 1,
+	// GOMAXPROCS is used.
+	Concurrency int `yaml:"concurrency,omitempty"`
+	// SkipCache disables the cache of files that are known to be formatted.
+	SkipCache bool `yaml:"skip-cache,omitempty"`
 }
 
 func UpgradeConfig(cfgBytes []byte) ([]byte, error) {
@@ -28,6 +36,22 @@ func UpgradeConfig(cfgBytes []byte) ([]byte, error) {
 	if err := yaml.UnmarshalStrict(cfgBytes, &cfg); err != nil {
 		return nil, errors.Wrapf(err, "failed to unmarshal gofmt-asset v0 configuration")
 	}
-	// input is valid current configuration: return input
-	return cfgBytes, nil
+	// empty configuration is valid for all versions: return input
+	var mapSlice yaml.MapSlice
+	if err := yaml.Unmarshal(cfgBytes, &mapSlice); err == nil && len(mapSlice) == 0 {
+		return cfgBytes, nil
+	}
+	upgradedCfg := v1.Config{
+		ConfigWithVersion: versionedconfig.ConfigWithVersion{
+			Version: "1",
+		},
+		SkipSimplify: cfg.SkipSimplify,
+		SkipCache:    cfg.SkipCache,
+		Concurrency:  cfg.Concurrency,
+	}
+	upgradedBytes, err := yaml.Marshal(upgradedCfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal gofmt-asset v1 configuration")
+	}
+	return upgradedBytes, nil
 }
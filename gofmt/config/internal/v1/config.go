@@ -0,0 +1,170 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"github.com/palantir/godel/v2/pkg/versionedconfig"
+	"github.com/palantir/pkg/matcher"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+type Config struct {
+	versionedconfig.ConfigWithVersion `yaml:",inline,omitempty"`
+	SkipSimplify                      bool `yaml:"skip-simplify,omitempty"`
+	// SkipSimplifyRules are the names of the simplification rules that are not applied: "composite-literal",
+	// "composite-literal-address", "slice-expression", "range" or "empty-decl-group". When verifying, the names of the
+	// simplification rules that would change each file are written to verify.output-file.
+	SkipSimplifyRules []string `yaml:"skip-simplify-rules,omitempty"`
+	// ExtraSimplifyRules are the names of the extra simplification rules, which are not performed by "gofmt -s", that
+	// are applied even if skip-simplify is true: "bool-literal-comparison", "return-bool-condition", "return-parens",
+	// "var-conversion", "trailing-break" or "else-after-return".
+	ExtraSimplifyRules []string `yaml:"extra-simplify-rules,omitempty"`
+	// RewriteRules are gofmt rewrite rules that are applied to every file in order before it is formatted. When
+	// verifying, the names of the rules that matched each file that is not formatted are written to verify.output-file.
+	RewriteRules []RewriteRule `yaml:"rewrite-rules,omitempty"`
+	// SkipCache disables the cache of files that are known to be formatted.
+	SkipCache bool `yaml:"skip-cache,omitempty"`
+	// Concurrency is the maximum number of files that are formatted in parallel. If unspecified or less than 1,
+	// GOMAXPROCS is used.
+	Concurrency int `yaml:"concurrency,omitempty"`
+	// Verify configures the output of verification.
+	Verify Verify `yaml:"verify,omitempty"`
+	// ChangedSince limits formatting to the files that differ between the working tree and the provided commit or
+	// branch of the local git repository. Untracked files are considered changed.
+	ChangedSince string `yaml:"changed-since,omitempty"`
+	// ChangedLinesOnly restricts the changes made by formatting to the changes that overlap lines that differ from
+	// changed-since, which must be specified, so that all other lines are left unchanged.
+	ChangedLinesOnly bool `yaml:"changed-lines-only,omitempty"`
+	// LineRanges restricts the changes made by formatting the provided files to the changes that overlap the provided
+	// line ranges. Files are specified relative to the project directory and ranges are of the form "<start>-<end>" or
+	// "<line>".
+	LineRanges map[string][]string `yaml:"line-ranges,omitempty"`
+	// Staged formats the content of files that is staged in the git index rather than their content in the working
+	// tree. Formatting a file stages its formatted content. Cannot be combined with changed-since.
+	Staged bool `yaml:"staged,omitempty"`
+	// StagedUpdateWorkingTree also writes the formatted content of staged files to the working tree if the file in the
+	// working tree is identical to its staged content.
+	StagedUpdateWorkingTree bool `yaml:"staged-update-working-tree,omitempty"`
+	// Generated determines how generated files, which contain a "// Code generated ... DO NOT EDIT." comment before
+	// their package clause, are treated: "format" (the default) formats them like any other file, "skip" neither
+	// formats nor verifies them and "verify-only" verifies them but never modifies them.
+	Generated string `yaml:"generated,omitempty"`
+	// Baseline is the path of a baseline file created by the "baseline" command. Files in the baseline whose content
+	// has not changed since the baseline was created are not verified, but they are still formatted. A relative path is
+	// resolved against the project directory.
+	Baseline string `yaml:"baseline,omitempty"`
+	// Overrides customize the configuration for the files that they match. The overrides that match a file are applied
+	// in order.
+	Overrides []Override `yaml:"overrides,omitempty"`
+	// PatchFile is the path of a file to which the changes made by formatting are written as a patch that can be applied
+	// with "git apply" from the top-level directory of the git repository that contains the project directory or, for
+	// the files in it, from the project directory. If the project directory is not in a git repository, the patch is
+	// applied from the project directory. If specified, files are never modified. A relative path is resolved against
+	// the project directory.
+	PatchFile string `yaml:"patch-file,omitempty"`
+	// Reports are machine-readable reports that are written whenever files are formatted or verified.
+	Reports []Report `yaml:"reports,omitempty"`
+	// Subprocess formats files by running the gofmt command in a separate process rather than in the asset process. It
+	// is a slower fallback for in-process formatting. Only skip-simplify, a single rewrite rule and changed-since are
+	// supported: skip-cache and concurrency are ignored and all other options are rejected.
+	Subprocess bool `yaml:"subprocess,omitempty"`
+}
+
+type Override struct {
+	// Match specifies the files to which the override applies using the semantics of the exclude configuration of
+	// godel: "names" are regular expressions that are matched against each component of the path of a file relative to
+	// the project directory, "paths" are glob patterns that are matched against the path and its parent directories
+	// and files that match "exclude" are not matched.
+	Match matcher.NamesPathsWithExcludeCfg `yaml:"match,omitempty"`
+	// SkipSimplify, if specified, replaces the skip-simplify configuration.
+	SkipSimplify *bool `yaml:"skip-simplify,omitempty"`
+	// SkipSimplifyRules, if specified, replaces the skip-simplify-rules configuration.
+	SkipSimplifyRules []string `yaml:"skip-simplify-rules,omitempty"`
+	// ExtraSimplifyRules, if specified, replaces the extra-simplify-rules configuration.
+	ExtraSimplifyRules []string `yaml:"extra-simplify-rules,omitempty"`
+	// RewriteRules are applied after the configured rewrite rules and the rewrite rules of previous overrides.
+	RewriteRules []RewriteRule `yaml:"rewrite-rules,omitempty"`
+	// Generated, if specified, replaces the generated configuration.
+	Generated string `yaml:"generated,omitempty"`
+}
+
+type Report struct {
+	// Format is the format of the report: "json", "sarif", "junit", "checkstyle" or "github".
+	Format string `yaml:"format,omitempty"`
+	// Path is the path of the report file. A relative path is resolved against the project directory. If the path is
+	// "-", the report is written to the output of the formatter, which the format plugin only shows when formatting
+	// rather than verifying files. A "github" report cannot be written to "-": the workflow commands in it only take
+	// effect once the file is printed by a workflow step.
+	Path string `yaml:"path,omitempty"`
+}
+
+type Verify struct {
+	// ShowDiff writes the unified diff for each file that is not formatted after the name of the file in output-file,
+	// which must be specified.
+	ShowDiff bool `yaml:"show-diff,omitempty"`
+	// DiffContext is the number of unchanged lines shown around each change. If unspecified, 3 lines are shown.
+	DiffContext *int `yaml:"diff-context,omitempty"`
+	// MaxHunks is the maximum number of hunks shown for each file. If unspecified or less than 1, all hunks are
+	// shown.
+	MaxHunks int `yaml:"max-hunks,omitempty"`
+	// OutputFile is the path of a file to which the complete output of verification is written: the names of the files
+	// that are not formatted, the rules that changed them and, if show-diff is true, their diffs. A relative path is
+	// resolved against the project directory. When verifying, the format plugin only shows the names of the files that
+	// are not formatted, so the rest of the output is only available in this file.
+	OutputFile string `yaml:"output-file,omitempty"`
+}
+
+func UpgradeConfig(cfgBytes []byte) ([]byte, error) {
+	var cfg Config
+	if err := yaml.UnmarshalStrict(cfgBytes, &cfg); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal gofmt-asset v1 configuration")
+	}
+	// input is valid current configuration: return input
+	return cfgBytes, nil
+}
+
+// RewriteRule is a gofmt rewrite rule of the form "pattern -> replacement". A rule can be specified either as a string
+// containing only the rule or as a map with "name" and "rule" keys. The name identifies the rule in output and errors
+// and defaults to the text of the rule.
+type RewriteRule struct {
+	Name string `yaml:"name,omitempty"`
+	Rule string `yaml:"rule,omitempty"`
+}
+
+type rewriteRuleAlias RewriteRule
+
+func (r *RewriteRule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var rule string
+	if err := unmarshal(&rule); err == nil {
+		*r = RewriteRule{
+			Rule: rule,
+		}
+		return nil
+	}
+	var alias rewriteRuleAlias
+	if err := unmarshal(&alias); err != nil {
+		return err
+	}
+	*r = RewriteRule(alias)
+	return nil
+}
+
+func (r RewriteRule) MarshalYAML() (interface{}, error) {
+	if r.Name == "" {
+		return r.Rule, nil
+	}
+	return rewriteRuleAlias(r), nil
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/pkg/errors"
 
 	v0 "github.com/palantir/godel-format-asset-gofmt/gofmt/config/internal/v0"
+	v1 "github.com/palantir/godel-format-asset-gofmt/gofmt/config/internal/v1"
 )
 
 func UpgradeConfig(cfgBytes []byte) ([]byte, error) {
@@ -29,6 +30,8 @@ func UpgradeConfig(cfgBytes []byte) ([]byte, error) {
 	switch version {
 	case "", "0":
 		return v0.UpgradeConfig(cfgBytes)
+	case "1":
+		return v1.UpgradeConfig(cfgBytes)
 	default:
 		return nil, errors.Errorf("unsupported version: %s", version)
 	}
@@ -0,0 +1,190 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/config"
+)
+
+func TestUpgradeConfig(t *testing.T) {
+	for i, tc := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "v0 configuration is upgraded to v1",
+			in: `skip-simplify: true
+skip-cache: true
+concurrency: 4
+`,
+			want: `version: "1"
+skip-simplify: true
+skip-cache: true
+concurrency: 4
+`,
+		},
+		{
+			name: "empty v0 configuration is not upgraded",
+			in:   "{}\n",
+			want: "{}\n",
+		},
+		{
+			name: "v1 configuration is not upgraded",
+			in: `version: 1
+skip-simplify: true
+`,
+			want: `version: 1
+skip-simplify: true
+`,
+		},
+		{
+			name: "v1 configuration with named and unnamed rewrite rules is not upgraded",
+			in: `version: 1
+rewrite-rules:
+  - "a[0:] -> a"
+  - name: slice-len
+    rule: "a[b:len(a)] -> a[b:]"
+`,
+			want: `version: 1
+rewrite-rules:
+  - "a[0:] -> a"
+  - name: slice-len
+    rule: "a[b:len(a)] -> a[b:]"
+`,
+		},
+		{
+			name: "v1 configuration with verify diff output is not upgraded",
+			in: `version: 1
+verify:
+  show-diff: true
+  diff-context: 0
+  max-hunks: 5
+`,
+			want: `version: 1
+verify:
+  show-diff: true
+  diff-context: 0
+  max-hunks: 5
+`,
+		},
+		{
+			name: "v1 configuration with patch file and reports is not upgraded",
+			in: `version: 1
+patch-file: out/gofmt.patch
+reports:
+  - format: json
+    path: out/gofmt.json
+`,
+			want: `version: 1
+patch-file: out/gofmt.patch
+reports:
+  - format: json
+    path: out/gofmt.json
+`,
+		},
+		{
+			name: "v1 configuration with overrides is not upgraded",
+			in: `version: 1
+overrides:
+  - match:
+      paths:
+        - legacy
+    skip-simplify: true
+  - match:
+      names:
+        - .*_gen\.go
+      exclude:
+        paths:
+          - internal/keep
+    generated: verify-only
+`,
+			want: `version: 1
+overrides:
+  - match:
+      paths:
+        - legacy
+    skip-simplify: true
+  - match:
+      names:
+        - .*_gen\.go
+      exclude:
+        paths:
+          - internal/keep
+    generated: verify-only
+`,
+		},
+		{
+			name: "v1 configuration with skipped simplification rules is not upgraded",
+			in: `version: 1
+skip-simplify-rules:
+  - composite-literal-address
+overrides:
+  - match:
+      paths:
+        - legacy
+    skip-simplify-rules:
+      - range
+`,
+			want: `version: 1
+skip-simplify-rules:
+  - composite-literal-address
+overrides:
+  - match:
+      paths:
+        - legacy
+    skip-simplify-rules:
+      - range
+`,
+		},
+		{
+			name: "v1 configuration with extra simplification rules is not upgraded",
+			in: `version: 1
+extra-simplify-rules:
+  - bool-literal-comparison
+  - else-after-return
+overrides:
+  - match:
+      names:
+        - .*_gen\.go
+    extra-simplify-rules: []
+`,
+			want: `version: 1
+extra-simplify-rules:
+  - bool-literal-comparison
+  - else-after-return
+overrides:
+  - match:
+      names:
+        - .*_gen\.go
+    extra-simplify-rules: []
+`,
+		},
+	} {
+		got, err := config.UpgradeConfig([]byte(tc.in))
+		require.NoError(t, err, "Case %d: %s", i, tc.name)
+		assert.Equal(t, tc.want, string(got), "Case %d: %s", i, tc.name)
+
+		// upgraded configuration is current and is not upgraded again
+		upgradedAgain, err := config.UpgradeConfig(got)
+		require.NoError(t, err, "Case %d: %s", i, tc.name)
+		assert.Equal(t, string(got), string(upgradedAgain), "Case %d: %s", i, tc.name)
+	}
+}
@@ -24,15 +24,66 @@ import (
 	"github.com/palantir/godel-format-asset-gofmt/gofmt/config"
 )
 
+// Flags are the values of the flags that the asset adds to the "run-format" command. Values that are set take
+// precedence over the configuration.
+type Flags struct {
+	ChangedSince string
+	// Staged formats the content of files that is staged in the git index.
+	Staged bool
+	// LineRanges are line ranges of files of the form "<path>:<range>[,<range>...]".
+	LineRanges []string
+}
+
 func Gofmt() formatter.Creator {
+	return GofmtWithFlags(nil)
+}
+
+// GofmtWithFlags returns a creator whose formatters use the values of the provided flags, which are read when each
+// formatter is created. If flags is nil, only the configuration is used.
+func GofmtWithFlags(flags *Flags) formatter.Creator {
 	return formatter.NewCreator(
 		gofmt.TypeName,
 		func(cfgYML []byte) (formatplugin.Formatter, error) {
+			upgradedCfgYML, err := config.UpgradeConfig(cfgYML)
+			if err != nil {
+				return nil, err
+			}
 			var formatCfg config.Gofmt
-			if err := yaml.Unmarshal(cfgYML, &formatCfg); err != nil {
+			if err := yaml.Unmarshal(upgradedCfgYML, &formatCfg); err != nil {
 				return nil, errors.Wrapf(err, "failed to unmarshal YAML")
 			}
-			return formatCfg.ToFormatter(), nil
+			gofmtFormatter, err := formatCfg.ToFormatter()
+			if err != nil {
+				return nil, err
+			}
+			if flags != nil {
+				if err := flags.apply(gofmtFormatter); err != nil {
+					return nil, err
+				}
+			}
+			return gofmtFormatter, nil
 		},
 	)
 }
+
+// apply sets the values of the flags that are set on the provided formatter.
+func (f *Flags) apply(gofmtFormatter *gofmt.Formatter) error {
+	if f.ChangedSince != "" {
+		gofmtFormatter.ChangedSince = f.ChangedSince
+	}
+	if f.Staged {
+		gofmtFormatter.Staged = true
+	}
+	if len(f.LineRanges) > 0 {
+		// line ranges specified as flags replace the configured line ranges
+		gofmtFormatter.LineRanges = make(map[string][]gofmt.LineRange)
+		for _, spec := range f.LineRanges {
+			path, ranges, err := gofmt.ParseFileLineRanges(spec)
+			if err != nil {
+				return err
+			}
+			gofmtFormatter.LineRanges[path] = append(gofmtFormatter.LineRanges[path], ranges...)
+		}
+	}
+	return nil
+}
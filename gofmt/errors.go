@@ -0,0 +1,150 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"fmt"
+	"go/scanner"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FileError is an error that prevented a file from being formatted, such as a parse error or a failure to read or
+// write the file.
+type FileError struct {
+	Filename string
+	// Line is the 1-based line of the error. 0 if the error is not associated with a position in the file.
+	Line int
+	// Column is the 1-based column of the error. 0 if the error is not associated with a position in the file.
+	Column int
+	Msg    string
+}
+
+func (e FileError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Filename, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.Filename, e.Line, e.Column, e.Msg)
+}
+
+// FormatError is returned by Formatter.Format if one or more files could not be formatted. Files that were formatted
+// successfully but need formatting are not errors: they are reported in the output of Format instead.
+type FormatError struct {
+	Errors []FileError
+}
+
+func (e *FormatError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, fileErr := range e.Errors {
+		lines[i] = fileErr.Error()
+	}
+	return fmt.Sprintf("failed to format %d file(s):\n%s", len(e.Files()), strings.Join(lines, "\n"))
+}
+
+// Files returns the names of the files that could not be formatted in the order in which they first appear in the
+// errors.
+func (e *FormatError) Files() []string {
+	var files []string
+	seen := make(map[string]struct{})
+	for _, fileErr := range e.Errors {
+		if _, ok := seen[fileErr.Filename]; ok {
+			continue
+		}
+		seen[fileErr.Filename] = struct{}{}
+		files = append(files, fileErr.Filename)
+	}
+	return files
+}
+
+// newFileErrors converts an error returned by the gofmt engine for the named file into FileErrors.
+func newFileErrors(filename string, err error) []FileError {
+	switch err := err.(type) {
+	case scanner.ErrorList:
+		fileErrs := make([]FileError, len(err))
+		for i, currErr := range err {
+			fileErrs[i] = newScannerFileError(filename, currErr)
+		}
+		return fileErrs
+	case *scanner.Error:
+		return []FileError{newScannerFileError(filename, err)}
+	case *os.PathError:
+		return []FileError{{
+			Filename: filename,
+			Msg:      fmt.Sprintf("%s: %v", err.Op, err.Err),
+		}}
+	default:
+		return []FileError{{
+			Filename: filename,
+			Msg:      err.Error(),
+		}}
+	}
+}
+
+func newScannerFileError(filename string, err *scanner.Error) FileError {
+	if err.Pos.Filename != "" {
+		filename = err.Pos.Filename
+	}
+	return FileError{
+		Filename: filename,
+		Line:     err.Pos.Line,
+		Column:   err.Pos.Column,
+		Msg:      err.Msg,
+	}
+}
+
+var errorLineRegexp = regexp.MustCompile(`^(.+?):([0-9]+):([0-9]+): (.*)$`)
+
+// parseFileErrors parses the error output written by the gofmt command into FileErrors. Lines that do not refer to one
+// of the provided file names are ignored.
+func parseFileErrors(output string, files []string) []FileError {
+	var fileErrs []FileError
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		if match := errorLineRegexp.FindStringSubmatch(line); match != nil && containsString(files, match[1]) {
+			lineNum, _ := strconv.Atoi(match[2])
+			colNum, _ := strconv.Atoi(match[3])
+			fileErrs = append(fileErrs, FileError{
+				Filename: match[1],
+				Line:     lineNum,
+				Column:   colNum,
+				Msg:      match[4],
+			})
+			continue
+		}
+		for _, file := range files {
+			if strings.Contains(line, file+": ") {
+				fileErrs = append(fileErrs, FileError{
+					Filename: file,
+					Msg:      strings.TrimPrefix(line, file+": "),
+				})
+				break
+			}
+		}
+	}
+	return fileErrs
+}
+
+func containsString(in []string, want string) bool {
+	for _, s := range in {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// GeneratedPolicy determines how generated files are treated. A file is generated if a comment of the form
+// "// Code generated ... DO NOT EDIT." precedes its package clause.
+type GeneratedPolicy string
+
+const (
+	// GeneratedFormat formats generated files like any other file. The empty policy is equivalent to GeneratedFormat.
+	GeneratedFormat GeneratedPolicy = "format"
+	// GeneratedSkip neither formats nor verifies generated files.
+	GeneratedSkip GeneratedPolicy = "skip"
+	// GeneratedVerifyOnly verifies generated files but never modifies them: generated files that are not formatted are
+	// listed in list mode and left unchanged otherwise.
+	GeneratedVerifyOnly GeneratedPolicy = "verify-only"
+)
+
+// ParseGeneratedPolicy returns the GeneratedPolicy with the provided name. The empty name is GeneratedFormat.
+func ParseGeneratedPolicy(name string) (GeneratedPolicy, error) {
+	switch policy := GeneratedPolicy(name); policy {
+	case "":
+		return GeneratedFormat, nil
+	case GeneratedFormat, GeneratedSkip, GeneratedVerifyOnly:
+		return policy, nil
+	default:
+		return "", errors.Errorf("unknown generated file policy %q: must be one of %s, %s, %s", name, GeneratedFormat, GeneratedSkip, GeneratedVerifyOnly)
+	}
+}
+
+// generatedSummary counts the generated files that were not formatted because of the generated file policy.
+type generatedSummary struct {
+	// skipped is the number of generated files that were skipped.
+	skipped int
+	// unmodified is the number of generated files that are not formatted but were not modified.
+	unmodified int
+}
+
+// print prints the summary to stdout. Nothing is printed if no generated files were left unformatted.
+func (s generatedSummary) print(stdout io.Writer) {
+	if s.skipped > 0 {
+		_, _ = fmt.Fprintf(stdout, "Skipped %d generated file(s)\n", s.skipped)
+	}
+	if s.unmodified > 0 {
+		_, _ = fmt.Fprintf(stdout, "Did not modify %d generated file(s) that are not formatted\n", s.unmodified)
+	}
+}
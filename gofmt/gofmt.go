@@ -15,25 +15,408 @@
 package gofmt
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/palantir/amalgomate/amalgomated"
 	"github.com/pkg/errors"
+
+	amalgomatedformatter "github.com/palantir/godel-format-asset-gofmt/generated_src"
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/internal/cache"
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/internal/git"
 )
 
 const TypeName = "gofmt"
 
+// RewriteRule is a gofmt rewrite rule of the form "pattern -> replacement".
+type RewriteRule = amalgomatedformatter.RewriteRule
+
+// ParseRewriteRule parses a gofmt rewrite rule of the form "pattern -> replacement". See the documentation of the "-r"
+// flag of gofmt for more information. If name is empty, the text of the rule is used as its name. The returned error
+// identifies the rule by name.
+func ParseRewriteRule(name, rule string) (RewriteRule, error) {
+	return amalgomatedformatter.ParseRewriteRule(name, rule)
+}
+
 type Formatter struct {
 	SkipSimplify bool
+	// SkipSimplifyRules are the names of the simplification rules, which are returned by SimplifyRules, that are not
+	// applied. The other rules are applied unless SkipSimplify is true. In list mode, the names of the rules that
+	// changed a file are printed after the file name and written to VerifyOutputFile.
+	SkipSimplifyRules []string
+	// ExtraSimplifyRules are the names of the extra simplification rules, which are returned by ExtraSimplifyRules,
+	// that are applied in addition to the simplification rules. The extra rules are applied even if SkipSimplify is
+	// true.
+	ExtraSimplifyRules []string
+	// RewriteRules are applied to every file in order before it is formatted. All of the rules are applied to a file
+	// in a single pass. In list mode, the names of the rules that matched a file are printed after the file name and
+	// written to VerifyOutputFile.
+	RewriteRules []RewriteRule
+	// CacheDir is the directory used to cache the content of files that are known to be formatted. If empty, no
+	// cache is used.
+	CacheDir string
+	// Concurrency is the maximum number of files that are formatted in parallel. If less than 1, the value of
+	// runtime.GOMAXPROCS(0) is used.
+	Concurrency int
+	// Diff prints the unified diff between the original and formatted content of each file after its name in list
+	// mode. The name of each file is still printed on its own line so that the file remains identifiable by callers
+	// that only consider lines that consist of a file name. The diffs are also written to VerifyOutputFile.
+	Diff bool
+	// DiffContext is the number of unchanged lines shown around each change in diffs. If negative,
+	// amalgomatedformatter.DefaultDiffContext is used.
+	DiffContext int
+	// MaxDiffHunks is the maximum number of hunks printed in the diff for each file. If less than 1, all hunks are
+	// printed.
+	MaxDiffHunks int
+	// VerifyOutputFile is the path of a file to which the output of list mode is also written. When verifying, the
+	// format plugin only shows the lines of the output that consist of a file name and discards the rest, such as
+	// diffs and the rules that changed each file. A relative path is resolved against the project directory. The file
+	// is replaced whenever files are listed and is not written otherwise.
+	VerifyOutputFile string
+	// Reports are written after all of the files have been processed. Reports describe every file, including files
+	// that are formatted.
+	Reports []ReportOutput
+	// ChangedSince limits formatting to the provided files that differ between the working tree and the commit
+	// identified by ChangedSince in the git repository that contains the project directory. Untracked files are
+	// considered changed. If empty, all of the provided files are formatted.
+	ChangedSince string
+	// ChangedLinesOnly restricts the changes made by formatting to the changes that overlap lines that differ between
+	// the working tree and ChangedSince, which must be specified. All other lines are left unchanged. Untracked files
+	// are formatted entirely.
+	ChangedLinesOnly bool
+	// LineRanges restricts the changes made by formatting the files with the provided paths to the changes that overlap
+	// the provided line ranges. All other lines are left unchanged. Relative paths are resolved against the project
+	// directory. Files that are not in LineRanges are formatted entirely unless ChangedLinesOnly is true, in which case
+	// the changed lines of the file are used as well.
+	LineRanges map[string][]LineRange
+	// PatchFile is the path of a file to which the changes made by formatting are written as a patch that can be
+	// applied with "git apply". A relative path is resolved against the project directory. The paths in the patch are
+	// relative to the top-level directory of the git repository that contains the project directory, so the patch can
+	// be applied from any directory in the repository, although "git apply" skips the files outside of the directory
+	// in which it is run. If the project directory is not in a git repository, the paths are relative to the project
+	// directory. Changes to files outside of the directory against which the paths are resolved are reported as
+	// errors. If PatchFile is non-empty, files are never modified.
+	PatchFile string
+	// Staged formats the content of the provided files that is staged in the index of the git repository that contains
+	// the project directory rather than their content in the working tree. Files that are not in the index are ignored.
+	// Formatting a file stages its formatted content and only modifies the file in the working tree if
+	// StagedUpdateWorkingTree is true. Staged cannot be combined with ChangedSince.
+	Staged bool
+	// StagedUpdateWorkingTree also writes the formatted content of a staged file to the working tree if the content of
+	// the file in the working tree is identical to its staged content. Partially staged files are never modified.
+	StagedUpdateWorkingTree bool
+	// Generated determines how generated files are treated. If empty, generated files are formatted like any other
+	// file.
+	Generated GeneratedPolicy
+	// Baseline is the path of a baseline file created by UpdateBaseline. In list mode, files in the baseline whose
+	// content is unchanged are not listed, so that only files that are new or changed must be formatted. Files in the
+	// baseline are still formatted when files are not listed. A relative path is resolved against the project
+	// directory. If empty, no baseline is used.
+	Baseline string
+	// Overrides customize the formatting of the files that they match. The overrides that match a file are applied in
+	// order.
+	Overrides []Override
+	// Subprocess runs gofmt by re-executing the asset binary with the amalgomated proxy prefix rather than formatting
+	// files in-process. It is a slower fallback for in-process formatting that supports SkipSimplify, a single rewrite
+	// rule and ChangedSince. CacheDir and Concurrency are ignored and Format returns an error if any other option is
+	// specified.
+	Subprocess bool
 }
 
 func (f *Formatter) TypeName() (string, error) {
 	return TypeName, nil
 }
 
+// Validate returns an error if the settings of the Formatter cannot be used together.
+func (f *Formatter) Validate() error {
+	if f.Staged && f.ChangedSince != "" {
+		return errors.Errorf("staged files cannot be restricted to files changed since a commit")
+	}
+	if f.Subprocess {
+		return f.validateSubprocess()
+	}
+	return nil
+}
+
+// Format formats the provided files. If list is true, the files that would be changed are printed to stdout rather
+// than being formatted. If any of the files cannot be formatted, a *FormatError is returned after all of the other
+// files have been processed. In list mode, the names of the files that could not be formatted are also printed so that
+// the run is reported as a failure by callers that only inspect the output.
 func (f *Formatter) Format(files []string, list bool, projectDir string, stdout io.Writer) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	if f.ChangedSince != "" {
+		changedFiles, err := filterChangedFiles(files, projectDir, f.ChangedSince)
+		if err != nil {
+			return err
+		}
+		files = changedFiles
+	}
+	if f.Subprocess {
+		return f.formatSubprocess(files, list, stdout)
+	}
+	var verifyOutput *bytes.Buffer
+	if list && f.VerifyOutputFile != "" {
+		verifyOutput = &bytes.Buffer{}
+		stdout = io.MultiWriter(stdout, verifyOutput)
+	}
+	var staged *stagedFiles
+	if f.Staged {
+		var err error
+		if staged, err = readStagedFiles(files, projectDir, f.StagedUpdateWorkingTree); err != nil {
+			return err
+		}
+		files = staged.files
+	}
+	lineRanges, err := f.lineRangesFunc(projectDir)
+	if err != nil {
+		return err
+	}
+	settings, err := f.fileSettings(files, projectDir, lineRanges)
+	if err != nil {
+		return err
+	}
+	var baseline *projectBaseline
+	if list {
+		// the baseline only exempts files from verification so that they can still be cleaned up by formatting
+		if baseline, err = f.readBaseline(projectDir); err != nil {
+			return err
+		}
+	}
+	opts := amalgomatedformatter.Options{
+		ForFile: func(filename string) amalgomatedformatter.Options {
+			return settings[filename].opts
+		},
+	}
+	var fileErrs []FileError
+	var report Report
+	var formatPatch *patch
+	if f.PatchFile != "" {
+		formatPatch = newPatch(projectDir)
+	}
+	var summary generatedSummary
+	write := amalgomatedformatter.Result.Write
+	if staged != nil {
+		write = staged.write
+	}
+	process := func(result amalgomatedformatter.Result) {
+		if baseline != nil && baseline.contains(result) {
+			// files in the baseline are not listed
+			if len(f.Reports) > 0 {
+				report.Files = append(report.Files, newBaselinedFileReport(result, projectDir))
+			}
+			return
+		}
+		resultSettings := settings[result.Filename]
+		resultErrs := f.processResult(result, list, resultSettings, write, stdout)
+		fileErrs = append(fileErrs, resultErrs...)
+		if len(f.Reports) > 0 {
+			report.Files = append(report.Files, newFileReport(result, resultErrs, projectDir, f.DiffContext))
+		}
+		if formatPatch != nil && result.Changed() && resultSettings.modifiable(result) {
+			if err := formatPatch.add(result, projectDir); err != nil {
+				fileErrs = append(fileErrs, newFileErrors(result.Filename, err)...)
+			}
+		}
+		if result.Skipped {
+			summary.skipped++
+		} else if result.Changed() && !resultSettings.modifiable(result) {
+			summary.unmodified++
+		}
+	}
+	if staged != nil {
+		amalgomatedformatter.FormatSources(files, staged.read, opts, f.Concurrency, process)
+	} else {
+		amalgomatedformatter.FormatFiles(files, opts, f.Concurrency, process)
+	}
+	if formatPatch != nil {
+		if err := formatPatch.write(f.PatchFile, projectDir); err != nil {
+			return err
+		}
+	}
+	if !list && !f.reportsToStdout() {
+		// the summary would corrupt a report written to stdout, which describes skipped files as well
+		summary.print(stdout)
+	}
+	if err := writeReports(f.Reports, report, projectDir, stdout); err != nil {
+		return err
+	}
+	formatErr := formatErrorOrNil(fileErrs, list, stdout)
+	if verifyOutput != nil {
+		if err := writeVerifyOutput(f.VerifyOutputFile, verifyOutput.Bytes(), projectDir); err != nil {
+			return err
+		}
+	}
+	return formatErr
+}
+
+// writeVerifyOutput writes the output of list mode to the file at path. A relative path is resolved against
+// projectDir.
+func writeVerifyOutput(path string, output []byte, projectDir string) error {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(projectDir, path)
+	}
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(output)
+		return err
+	}); err != nil {
+		return errors.Wrapf(err, "failed to write verify output %s", path)
+	}
+	return nil
+}
+
+// filterChangedFiles returns the provided files that differ between the working tree and ref in the git repository
+// that contains projectDir, or the working directory if projectDir is empty.
+func filterChangedFiles(files []string, projectDir, ref string) ([]string, error) {
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to determine absolute path of %q", projectDir)
+	}
+	changedFiles, err := git.ChangedFiles(dir, ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to determine files changed since %s", ref)
+	}
+	changed := make(map[string]struct{}, len(changedFiles))
+	for _, file := range changedFiles {
+		changed[file] = struct{}{}
+	}
+	var filtered []string
+	for _, file := range files {
+		absFile, err := filepath.Abs(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to determine absolute path of %q", file)
+		}
+		if _, ok := changed[absFile]; ok {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered, nil
+}
+
+// processResult prints or writes the provided result, which was formatted with the provided settings, using write and
+// returns the errors that occurred while formatting or writing the file.
+func (f *Formatter) processResult(result amalgomatedformatter.Result, list bool, settings *fileSettings, write func(amalgomatedformatter.Result) error, stdout io.Writer) []FileError {
+	if result.Err != nil {
+		return newFileErrors(result.Filename, result.Err)
+	}
+	if !result.Changed() {
+		if settings.cache != nil && !result.Cached && !result.Skipped {
+			settings.cache.SetFormatted(result.Src)
+		}
+		return nil
+	}
+	if list {
+		_, _ = fmt.Fprintln(stdout, result.Filename)
+		for _, rule := range result.RewriteRules {
+			_, _ = fmt.Fprintf(stdout, "%s: rewrite rule %q matched\n", result.Filename, rule)
+		}
+		for _, rule := range result.Simplifications {
+			_, _ = fmt.Fprintf(stdout, "%s: simplification rule %q applied\n", result.Filename, rule)
+		}
+		if f.Diff {
+			f.printDiff(result, stdout)
+		}
+		return nil
+	}
+	if f.PatchFile != "" {
+		// changes are written to the patch rather than to the file
+		return nil
+	}
+	if !settings.modifiable(result) {
+		return nil
+	}
+	if err := write(result); err != nil {
+		return newFileErrors(result.Filename, err)
+	}
+	return nil
+}
+
+// reportsToStdout returns true if any of the reports are written to stdout.
+func (f *Formatter) reportsToStdout() bool {
+	for _, output := range f.Reports {
+		if output.Path == StdoutReportPath {
+			return true
+		}
+	}
+	return false
+}
+
+// printDiff prints the diff for the provided result truncated to f.MaxDiffHunks hunks.
+func (f *Formatter) printDiff(result amalgomatedformatter.Result, stdout io.Writer) {
+	diff, omitted := amalgomatedformatter.TruncateDiff(result.Diff(f.DiffContext), f.MaxDiffHunks)
+	_, _ = stdout.Write(diff)
+	if omitted > 0 {
+		_, _ = fmt.Fprintf(stdout, "%s: %d more hunk(s) omitted\n", result.Filename, omitted)
+	}
+}
+
+// newCache returns the cache used to skip files that are known to be formatted using the provided options. Returns
+// nil if caching is disabled or the cache cannot be created, since caching is only an optimization.
+func (f *Formatter) newCache(opts amalgomatedformatter.Options) *cache.Cache {
+	if f.CacheDir == "" {
+		return nil
+	}
+	cfgKey, err := json.Marshal(opts)
+	if err != nil {
+		return nil
+	}
+	formattedCache, err := cache.New(f.CacheDir, cfgKey)
+	if err != nil {
+		return nil
+	}
+	return formattedCache
+}
+
+// validateSubprocess returns an error if the Formatter has settings that are not supported when formatting in a
+// subprocess.
+func (f *Formatter) validateSubprocess() error {
+	if f.Diff {
+		return errors.Errorf("diff output is not supported when formatting in a subprocess")
+	}
+	if len(f.Reports) > 0 {
+		return errors.Errorf("reports are not supported when formatting in a subprocess")
+	}
+	if f.PatchFile != "" {
+		return errors.Errorf("patch files are not supported when formatting in a subprocess")
+	}
+	if f.VerifyOutputFile != "" {
+		return errors.Errorf("verify output files are not supported when formatting in a subprocess")
+	}
+	if f.ChangedLinesOnly || len(f.LineRanges) > 0 {
+		return errors.Errorf("restricting formatting to lines is not supported when formatting in a subprocess")
+	}
+	if f.Staged {
+		return errors.Errorf("staged files cannot be formatted in a subprocess")
+	}
+	if len(f.Overrides) > 0 {
+		return errors.Errorf("overrides are not supported when formatting in a subprocess")
+	}
+	if f.Baseline != "" {
+		return errors.Errorf("baselines are not supported when formatting in a subprocess")
+	}
+	if f.Generated != "" && f.Generated != GeneratedFormat {
+		return errors.Errorf("generated file policy %q is not supported when formatting in a subprocess", f.Generated)
+	}
+	if len(f.SkipSimplifyRules) > 0 {
+		return errors.Errorf("skipping simplification rules is not supported when formatting in a subprocess")
+	}
+	if len(f.ExtraSimplifyRules) > 0 {
+		return errors.Errorf("extra simplification rules are not supported when formatting in a subprocess")
+	}
+	if len(f.RewriteRules) > 1 {
+		return errors.Errorf("gofmt command supports only a single rewrite rule, but %d were specified", len(f.RewriteRules))
+	}
+	return nil
+}
+
+func (f *Formatter) formatSubprocess(files []string, list bool, stdout io.Writer) error {
 	self, err := os.Executable()
 	if err != nil {
 		return errors.Wrapf(err, "failed to determine executable")
@@ -49,15 +432,40 @@ func (f *Formatter) Format(files []string, list bool, projectDir string, stdout
 	if !f.SkipSimplify {
 		args = append(args, "-s")
 	}
+	if len(f.RewriteRules) > 0 {
+		args = append(args, "-r", f.RewriteRules[0].Rule)
+	}
 	args = append(args, files...)
 
+	stderr := &bytes.Buffer{}
 	cmd := exec.Command(self, args...)
 	cmd.Stdout = stdout
-	cmd.Stderr = stdout
+	cmd.Stderr = stderr
 	if err := cmd.Run(); err != nil {
 		if _, ok := err.(*exec.ExitError); !ok {
 			return errors.Wrapf(err, "failed to run %v", cmd.Args)
 		}
+		if fileErrs := parseFileErrors(stderr.String(), files); len(fileErrs) > 0 {
+			return formatErrorOrNil(fileErrs, list, stdout)
+		}
+		return errors.Wrapf(err, "failed to run %v: %s", cmd.Args, strings.TrimSpace(stderr.String()))
 	}
 	return nil
 }
+
+// formatErrorOrNil returns a *FormatError for the provided errors, or nil if there are none. If list is true, the
+// names of the files that could not be formatted are printed to stdout.
+func formatErrorOrNil(fileErrs []FileError, list bool, stdout io.Writer) error {
+	if len(fileErrs) == 0 {
+		return nil
+	}
+	formatErr := &FormatError{
+		Errors: fileErrs,
+	}
+	if list {
+		for _, file := range formatErr.Files() {
+			_, _ = fmt.Fprintln(stdout, file)
+		}
+	}
+	return formatErr
+}
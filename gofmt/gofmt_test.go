@@ -0,0 +1,1159 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/palantir/pkg/matcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/godel-format-asset-gofmt/gofmt"
+)
+
+const (
+	unformattedSrc = `package foo
+
+import (
+	_ "os"
+	_ "fmt"
+)
+
+func Foo() {
+	for _ = range []string{} {
+	}
+}
+`
+	formattedSrc = `package foo
+
+import (
+	_ "fmt"
+	_ "os"
+)
+
+func Foo() {
+	for range []string{} {
+	}
+}
+`
+	generatedPrefix = "// Code generated by foo-gen. DO NOT EDIT.\n\n"
+)
+
+func TestFormat(t *testing.T) {
+	for i, tc := range []struct {
+		name       string
+		formatter  gofmt.Formatter
+		src        string
+		list       bool
+		wantOutput func(dir string) string
+		wantErr    func(dir string) error
+		wantSrc    string
+	}{
+		{
+			name:    "formats file in-process",
+			src:     unformattedSrc,
+			wantSrc: formattedSrc,
+		},
+		{
+			name: "lists file in-process",
+			src:  unformattedSrc,
+			list: true,
+			wantOutput: func(dir string) string {
+				return listedUnformatted(filepath.Join(dir, "foo.go"))
+			},
+			wantSrc: unformattedSrc,
+		},
+		{
+			name: "lists file with diff",
+			formatter: gofmt.Formatter{
+				Diff:        true,
+				DiffContext: 1,
+			},
+			src:  unformattedSrc,
+			list: true,
+			wantOutput: func(dir string) string {
+				file := filepath.Join(dir, "foo.go")
+				return listedUnformatted(file) +
+					"--- " + filepath.ToSlash(file) + ".orig\n" +
+					"+++ " + filepath.ToSlash(file) + "\n" +
+					"@@ -3,4 +3,4 @@\n" +
+					" import (\n" +
+					"-\t_ \"os\"\n" +
+					" \t_ \"fmt\"\n" +
+					"+\t_ \"os\"\n" +
+					" )\n" +
+					"@@ -8,3 +8,3 @@\n" +
+					" func Foo() {\n" +
+					"-\tfor _ = range []string{} {\n" +
+					"+\tfor range []string{} {\n" +
+					" \t}\n"
+			},
+			wantSrc: unformattedSrc,
+		},
+		{
+			name: "lists file with diff truncated to maximum number of hunks",
+			formatter: gofmt.Formatter{
+				Diff:         true,
+				DiffContext:  1,
+				MaxDiffHunks: 1,
+			},
+			src:  unformattedSrc,
+			list: true,
+			wantOutput: func(dir string) string {
+				file := filepath.Join(dir, "foo.go")
+				return listedUnformatted(file) +
+					"--- " + filepath.ToSlash(file) + ".orig\n" +
+					"+++ " + filepath.ToSlash(file) + "\n" +
+					"@@ -3,4 +3,4 @@\n" +
+					" import (\n" +
+					"-\t_ \"os\"\n" +
+					" \t_ \"fmt\"\n" +
+					"+\t_ \"os\"\n" +
+					" )\n" +
+					file + ": 1 more hunk(s) omitted\n"
+			},
+			wantSrc: unformattedSrc,
+		},
+		{
+			name: "applies rewrite rules in order",
+			formatter: gofmt.Formatter{
+				RewriteRules: []gofmt.RewriteRule{
+					mustParseRewriteRule(t, "", "a[b:len(a)] -> a[b:]"),
+					mustParseRewriteRule(t, "", "a[0:] -> a"),
+				},
+			},
+			src:     "package foo\n\nfunc Foo(s []int) ([]int, []int) {\n\treturn s[0:len(s)], s[1:len(s)]\n}\n",
+			wantSrc: "package foo\n\nfunc Foo(s []int) ([]int, []int) {\n\treturn s, s[1:]\n}\n",
+		},
+		{
+			name: "skips simplification rules",
+			formatter: gofmt.Formatter{
+				SkipSimplifyRules: []string{"range"},
+			},
+			src:     unformattedSrc,
+			wantSrc: strings.Replace(formattedSrc, "for range", "for _ = range", 1),
+		},
+		{
+			name: "lists file formatted without skipped simplification rules",
+			formatter: gofmt.Formatter{
+				SkipSimplifyRules: []string{"range"},
+			},
+			src:  unformattedSrc,
+			list: true,
+			wantOutput: func(dir string) string {
+				return filepath.Join(dir, "foo.go") + "\n"
+			},
+			wantSrc: unformattedSrc,
+		},
+		{
+			name: "applies extra simplification rules",
+			formatter: gofmt.Formatter{
+				ExtraSimplifyRules: gofmt.ExtraSimplifyRules(),
+			},
+			src: "package foo\n\nfunc Foo(a, b int, ok bool) bool {\n\tif (a < b) == false {\n\t\treturn (a > b)\n\t}\n" +
+				"\tvar c int64 = int64(a)\n\tswitch c {\n\tcase 1:\n\t\tBar()\n\t\tbreak\n\t}\n" +
+				"\tif a > b {\n\t\treturn false\n\t} else {\n\t\t// compare with c\n\t\tif int64(b) == c {\n\t\t\treturn true\n\t\t}\n\t\treturn false\n\t}\n}\n",
+			wantSrc: "package foo\n\nfunc Foo(a, b int, ok bool) bool {\n\tif !(a < b) {\n\t\treturn a > b\n\t}\n" +
+				"\tvar c = int64(a)\n\tswitch c {\n\tcase 1:\n\t\tBar()\n\t}\n" +
+				"\tif a > b {\n\t\treturn false\n\t}\n\t// compare with c\n\treturn int64(b) == c\n}\n",
+		},
+		{
+			name: "applies extra simplification rules if simplification is skipped",
+			formatter: gofmt.Formatter{
+				SkipSimplify:       true,
+				ExtraSimplifyRules: []string{"return-parens"},
+			},
+			src:     "package foo\n\nfunc Foo() []int {\n\tfor _ = range []string{} {\n\t}\n\treturn ([]int{})\n}\n",
+			wantSrc: "package foo\n\nfunc Foo() []int {\n\tfor _ = range []string{} {\n\t}\n\treturn []int{}\n}\n",
+		},
+		{
+			name: "does not simplify comparisons of operands that may not be booleans",
+			formatter: gofmt.Formatter{
+				ExtraSimplifyRules: []string{"bool-literal-comparison"},
+			},
+			src:     "package foo\n\nfunc Foo(x interface{}, p *bool) {\n\tif x == true {\n\t}\n\tif *p != false {\n\t}\n\tfor f() == true {\n\t}\n}\n",
+			wantSrc: "package foo\n\nfunc Foo(x interface{}, p *bool) {\n\tif x == true {\n\t}\n\tif *p != false {\n\t}\n\tfor f() == true {\n\t}\n}\n",
+		},
+		{
+			name: "does not return conditions that may not be untyped booleans",
+			formatter: gofmt.Formatter{
+				ExtraSimplifyRules: []string{"return-bool-condition"},
+			},
+			src:     "package foo\n\nfunc Foo(ok bool) bool {\n\tif ok {\n\t\treturn true\n\t}\n\treturn false\n}\n",
+			wantSrc: "package foo\n\nfunc Foo(ok bool) bool {\n\tif ok {\n\t\treturn true\n\t}\n\treturn false\n}\n",
+		},
+		{
+			name: "lists extra simplification rules that changed file",
+			formatter: gofmt.Formatter{
+				ExtraSimplifyRules: []string{"var-conversion", "trailing-break"},
+			},
+			src:  "package foo\n\nvar x int64 = int64(1)\n",
+			list: true,
+			wantOutput: func(dir string) string {
+				file := filepath.Join(dir, "foo.go")
+				return file + "\n" +
+					file + `: simplification rule "var-conversion" applied` + "\n"
+			},
+			wantSrc: "package foo\n\nvar x int64 = int64(1)\n",
+		},
+		{
+			name: "lists rewrite rules that matched",
+			formatter: gofmt.Formatter{
+				SkipSimplify: true,
+				RewriteRules: []gofmt.RewriteRule{
+					mustParseRewriteRule(t, "slice-len", "a[b:len(a)] -> a[b:]"),
+					mustParseRewriteRule(t, "unused", "a[0:1] -> a[:1]"),
+					mustParseRewriteRule(t, "", "a[0:] -> a"),
+				},
+			},
+			src:  "package foo\n\nfunc Foo(s []int) []int {\n\treturn s[0:len(s)]\n}\n",
+			list: true,
+			wantOutput: func(dir string) string {
+				file := filepath.Join(dir, "foo.go")
+				return file + "\n" +
+					file + `: rewrite rule "slice-len" matched` + "\n" +
+					file + `: rewrite rule "a[0:] -> a" matched` + "\n"
+			},
+			wantSrc: "package foo\n\nfunc Foo(s []int) []int {\n\treturn s[0:len(s)]\n}\n",
+		},
+		{
+			name: "applies statement rewrite rules",
+			formatter: gofmt.Formatter{
+				RewriteRules: []gofmt.RewriteRule{
+					mustParseRewriteRule(t, "", "for _, v := range y { x = append(x, v) } -> x = append(x, y...)"),
+				},
+			},
+			src:     "package foo\n\nfunc Foo(x, y []int) []int {\n\tfor _, v := range y {\n\t\t// append all\n\t\tx = append(x, v)\n\t}\n\treturn x\n}\n",
+			wantSrc: "package foo\n\nfunc Foo(x, y []int) []int {\n\t// append all\n\tx = append(x, y...)\n\treturn x\n}\n",
+		},
+		{
+			name: "applies statement rewrite rules with list wildcards",
+			formatter: gofmt.Formatter{
+				RewriteRules: []gofmt.RewriteRule{
+					mustParseRewriteRule(t, "", "m.Lock(); s_; m.Unlock() -> m.Lock(); defer m.Unlock(); s_"),
+				},
+			},
+			src:     "package foo\n\nfunc Foo() {\n\tm.Lock()\n\ta()\n\tb()\n\tm.Unlock()\n}\n",
+			wantSrc: "package foo\n\nfunc Foo() {\n\tm.Lock()\n\tdefer m.Unlock()\n\ta()\n\tb()\n}\n",
+		},
+		{
+			name: "applies only changes that overlap line ranges",
+			formatter: gofmt.Formatter{
+				LineRanges: map[string][]gofmt.LineRange{
+					"foo.go": {{Start: 9, End: 9}},
+				},
+			},
+			src:     unformattedSrc,
+			wantSrc: strings.Replace(unformattedSrc, "for _ = range", "for range", 1),
+		},
+		{
+			name: "applies related changes within declarations that overlap line ranges",
+			formatter: gofmt.Formatter{
+				LineRanges: map[string][]gofmt.LineRange{
+					"foo.go": {{Start: 4, End: 4}},
+				},
+			},
+			src:     unformattedSrc,
+			wantSrc: strings.Replace(formattedSrc, "for range", "for _ = range", 1),
+		},
+		{
+			name: "does not list file if no changes overlap line ranges",
+			formatter: gofmt.Formatter{
+				LineRanges: map[string][]gofmt.LineRange{
+					"foo.go": {{Start: 1, End: 2}},
+				},
+			},
+			src:     unformattedSrc,
+			list:    true,
+			wantSrc: unformattedSrc,
+		},
+		{
+			name: "parse errors are returned as FormatError",
+			src:  "package foo\n\nfunc Foo( {}\n",
+			wantErr: func(dir string) error {
+				return &gofmt.FormatError{
+					Errors: []gofmt.FileError{
+						{
+							Filename: filepath.Join(dir, "foo.go"),
+							Line:     3,
+							Column:   11,
+							Msg:      "expected ')', found '{'",
+						},
+					},
+				}
+			},
+			wantSrc: "package foo\n\nfunc Foo( {}\n",
+		},
+		{
+			name: "files with parse errors are listed",
+			src:  "package foo\n\nfunc Foo( {}\n",
+			list: true,
+			wantOutput: func(dir string) string {
+				return filepath.Join(dir, "foo.go") + "\n"
+			},
+			wantErr: func(dir string) error {
+				return &gofmt.FormatError{
+					Errors: []gofmt.FileError{
+						{
+							Filename: filepath.Join(dir, "foo.go"),
+							Line:     3,
+							Column:   11,
+							Msg:      "expected ')', found '{'",
+						},
+					},
+				}
+			},
+			wantSrc: "package foo\n\nfunc Foo( {}\n",
+		},
+		{
+			name:    "formats generated file by default",
+			src:     generatedPrefix + unformattedSrc,
+			wantSrc: generatedPrefix + formattedSrc,
+		},
+		{
+			name: "skips generated file",
+			formatter: gofmt.Formatter{
+				Generated: gofmt.GeneratedSkip,
+			},
+			src: generatedPrefix + unformattedSrc,
+			wantOutput: func(dir string) string {
+				return "Skipped 1 generated file(s)\n"
+			},
+			wantSrc: generatedPrefix + unformattedSrc,
+		},
+		{
+			name: "does not list skipped generated file",
+			formatter: gofmt.Formatter{
+				Generated: gofmt.GeneratedSkip,
+			},
+			src:     generatedPrefix + unformattedSrc,
+			list:    true,
+			wantSrc: generatedPrefix + unformattedSrc,
+		},
+		{
+			name: "does not modify verify-only generated file",
+			formatter: gofmt.Formatter{
+				Generated: gofmt.GeneratedVerifyOnly,
+			},
+			src: generatedPrefix + unformattedSrc,
+			wantOutput: func(dir string) string {
+				return "Did not modify 1 generated file(s) that are not formatted\n"
+			},
+			wantSrc: generatedPrefix + unformattedSrc,
+		},
+		{
+			name: "lists verify-only generated file",
+			formatter: gofmt.Formatter{
+				Generated: gofmt.GeneratedVerifyOnly,
+			},
+			src:  generatedPrefix + unformattedSrc,
+			list: true,
+			wantOutput: func(dir string) string {
+				return listedUnformatted(filepath.Join(dir, "foo.go"))
+			},
+			wantSrc: generatedPrefix + unformattedSrc,
+		},
+		{
+			name: "generated comment after package clause does not mark file as generated",
+			formatter: gofmt.Formatter{
+				Generated: gofmt.GeneratedSkip,
+			},
+			src:     unformattedSrc + "\n// Code generated by foo-gen. DO NOT EDIT.\n",
+			wantSrc: formattedSrc + "\n// Code generated by foo-gen. DO NOT EDIT.\n",
+		},
+		{
+			name:    "keeps regions suppressed by directives",
+			src:     "package  foo\n\nvar table = [][]int{\n\t//gofmt:off\n\t{1,   2},\n\t{10,  20},\n\t//gofmt:on\n\t{3,   4},\n}\n",
+			wantSrc: "package foo\n\nvar table = [][]int{\n\t//gofmt:off\n\t{1,   2},\n\t{10,  20},\n\t//gofmt:on\n\t{3, 4},\n}\n",
+		},
+		{
+			name:    "does not list file that is formatted outside of suppressed regions",
+			src:     "package foo\n\n//gofmt:off\nfunc  Foo()  {}\n",
+			list:    true,
+			wantSrc: "package foo\n\n//gofmt:off\nfunc  Foo()  {}\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "")
+			require.NoError(t, err)
+			defer func() {
+				_ = os.RemoveAll(dir)
+			}()
+
+			file := filepath.Join(dir, "foo.go")
+			require.NoError(t, ioutil.WriteFile(file, []byte(tc.src), 0644))
+
+			buf := &bytes.Buffer{}
+			err = tc.formatter.Format([]string{file}, tc.list, dir, buf)
+			if tc.wantErr == nil {
+				require.NoError(t, err, "Case %d: %s", i, tc.name)
+			} else {
+				assert.Equal(t, tc.wantErr(dir), err, "Case %d: %s", i, tc.name)
+			}
+
+			wantOutput := ""
+			if tc.wantOutput != nil {
+				wantOutput = tc.wantOutput(dir)
+			}
+			assert.Equal(t, wantOutput, buf.String(), "Case %d: %s", i, tc.name)
+
+			gotSrc, err := ioutil.ReadFile(file)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantSrc, string(gotSrc), "Case %d: %s", i, tc.name)
+		})
+	}
+}
+
+func TestFormatListsFilesInInputOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	var files []string
+	for i := 0; i < 50; i++ {
+		file := filepath.Join(dir, fmt.Sprintf("foo_%d.go", i))
+		src := unformattedSrc
+		if i%3 == 0 {
+			src = formattedSrc
+		}
+		require.NoError(t, ioutil.WriteFile(file, []byte(src), 0644))
+		files = append(files, file)
+	}
+
+	var want string
+	for i, file := range files {
+		if i%3 != 0 {
+			want += listedUnformatted(file)
+		}
+	}
+
+	formatter := &gofmt.Formatter{
+		Concurrency: 8,
+	}
+	buf := &bytes.Buffer{}
+	require.NoError(t, formatter.Format(files, true, dir, buf))
+	assert.Equal(t, want, buf.String())
+}
+
+func TestFormatWritesReports(t *testing.T) {
+	for i, tc := range []struct {
+		name   string
+		format gofmt.ReportFormat
+		want   string
+	}{
+		{
+			name:   "JSON report",
+			format: gofmt.JSONReportFormat,
+			want: `{
+  "version": 1,
+  "files": [
+    {
+      "path": "pkg/formatted.go",
+      "status": "formatted"
+    },
+    {
+      "path": "pkg/unformatted.go",
+      "status": "changed",
+      "hunks": [
+        {
+          "oldStart": 4,
+          "oldLines": 1,
+          "newStart": 4,
+          "newLines": 1,
+          "lines": [
+            "-\tfor _ = range s[0:] {",
+            "+\tfor range s {"
+          ]
+        }
+      ],
+      "rewriteRules": [
+        "slice-zero"
+      ],
+      "simplifications": [
+        "range"
+      ]
+    },
+    {
+      "path": "pkg/invalid.go",
+      "status": "error",
+      "errors": [
+        {
+          "line": 3,
+          "column": 11,
+          "message": "expected ')', found '{'"
+        }
+      ]
+    }
+  ]
+}
+`,
+		},
+		{
+			name:   "SARIF report",
+			format: gofmt.SARIFReportFormat,
+			want: `{
+  "$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+  "version": "2.1.0",
+  "runs": [
+    {
+      "tool": {
+        "driver": {
+          "name": "gofmt",
+          "informationUri": "https://golang.org/cmd/gofmt",
+          "rules": [
+            {
+              "id": "gofmt/unformatted",
+              "shortDescription": {
+                "text": "File is not formatted with gofmt."
+              }
+            },
+            {
+              "id": "gofmt/parse-error",
+              "shortDescription": {
+                "text": "File cannot be formatted with gofmt."
+              }
+            }
+          ]
+        }
+      },
+      "results": [
+        {
+          "ruleId": "gofmt/unformatted",
+          "level": "error",
+          "message": {
+            "text": "Line 4 is not formatted with gofmt."
+          },
+          "locations": [
+            {
+              "physicalLocation": {
+                "artifactLocation": {
+                  "uri": "pkg/unformatted.go",
+                  "uriBaseId": "%SRCROOT%"
+                },
+                "region": {
+                  "startLine": 4,
+                  "endLine": 4
+                }
+              }
+            }
+          ],
+          "fixes": [
+            {
+              "description": {
+                "text": "Format with gofmt."
+              },
+              "artifactChanges": [
+                {
+                  "artifactLocation": {
+                    "uri": "pkg/unformatted.go",
+                    "uriBaseId": "%SRCROOT%"
+                  },
+                  "replacements": [
+                    {
+                      "deletedRegion": {
+                        "startLine": 4,
+                        "startColumn": 1,
+                        "endLine": 5,
+                        "endColumn": 1
+                      },
+                      "insertedContent": {
+                        "text": "\tfor range s {\n"
+                      }
+                    }
+                  ]
+                }
+              ]
+            }
+          ]
+        },
+        {
+          "ruleId": "gofmt/parse-error",
+          "level": "error",
+          "message": {
+            "text": "expected ')', found '{'"
+          },
+          "locations": [
+            {
+              "physicalLocation": {
+                "artifactLocation": {
+                  "uri": "pkg/invalid.go",
+                  "uriBaseId": "%SRCROOT%"
+                },
+                "region": {
+                  "startLine": 3,
+                  "startColumn": 11
+                }
+              }
+            }
+          ]
+        }
+      ]
+    }
+  ]
+}
+`,
+		},
+		{
+			name:   "JUnit report",
+			format: gofmt.JUnitReportFormat,
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="gofmt" tests="3" failures="1" errors="1">
+    <testcase name="pkg/formatted.go" classname="gofmt"></testcase>
+    <testcase name="pkg/unformatted.go" classname="gofmt">
+      <failure message="pkg/unformatted.go is not formatted" type="gofmt/unformatted">--- pkg/unformatted.go.orig&#xA;+++ pkg/unformatted.go&#xA;@@ -4 +4 @@&#xA;-&#x9;for _ = range s[0:] {&#xA;+&#x9;for range s {&#xA;</failure>
+    </testcase>
+    <testcase name="pkg/invalid.go" classname="gofmt">
+      <error message="pkg/invalid.go cannot be formatted" type="gofmt/parse-error">pkg/invalid.go:3:11: expected &#39;)&#39;, found &#39;{&#39;</error>
+    </testcase>
+  </testsuite>
+</testsuites>
+`,
+		},
+		{
+			name:   "Checkstyle report",
+			format: gofmt.CheckstyleReportFormat,
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="5.0">
+  <file name="pkg/formatted.go"></file>
+  <file name="pkg/unformatted.go">
+    <error line="4" severity="error" message="Line 4 is not formatted with gofmt." source="gofmt/unformatted"></error>
+  </file>
+  <file name="pkg/invalid.go">
+    <error line="3" column="11" severity="error" message="expected &#39;)&#39;, found &#39;{&#39;" source="gofmt/parse-error"></error>
+  </file>
+</checkstyle>
+`,
+		},
+		{
+			name:   "GitHub workflow command report",
+			format: gofmt.GitHubReportFormat,
+			want: `::error file=pkg/unformatted.go,line=4,endLine=4,title=gofmt/unformatted::Line 4 is not formatted with gofmt.
+::error file=pkg/invalid.go,line=3,col=11,title=gofmt/parse-error::expected ')', found '{'
+`,
+		},
+	} {
+		got := formatWithReport(t, tc.format)
+		assert.Equal(t, tc.want, got, "Case %d: %s", i, tc.name)
+	}
+}
+
+// formatWithReport verifies a formatted file, a file that is changed by formatting and a file that cannot be parsed
+// and returns the content of the report written in the provided format.
+func formatWithReport(t *testing.T, format gofmt.ReportFormat) string {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	var files []string
+	for _, file := range []struct {
+		name string
+		src  string
+	}{
+		{name: "formatted.go", src: formattedSrc},
+		{name: "unformatted.go", src: "package foo\n\nfunc Foo(s []int) {\n\tfor _ = range s[0:] {\n\t}\n}\n"},
+		{name: "invalid.go", src: "package foo\n\nfunc Foo( {}\n"},
+	} {
+		path := filepath.Join(dir, "pkg", file.name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(file.src), 0644))
+		files = append(files, path)
+	}
+
+	formatter := &gofmt.Formatter{
+		RewriteRules: []gofmt.RewriteRule{
+			mustParseRewriteRule(t, "slice-zero", "a[0:] -> a"),
+		},
+		DiffContext: 0,
+		Reports: []gofmt.ReportOutput{
+			{
+				Format: format,
+				Path:   filepath.Join("out", "report"),
+			},
+		},
+	}
+	err = formatter.Format(files, true, dir, ioutil.Discard)
+	require.Error(t, err)
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "out", "report"))
+	require.NoError(t, err)
+	return string(got)
+}
+
+func TestFormatWritesPatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	var files []string
+	for _, file := range []struct {
+		name string
+		src  string
+	}{
+		{name: "formatted.go", src: formattedSrc},
+		{name: "unformatted.go", src: unformattedSrc},
+	} {
+		path := filepath.Join(dir, "pkg", file.name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(file.src), 0644))
+		files = append(files, path)
+	}
+
+	formatter := &gofmt.Formatter{
+		PatchFile: "gofmt.patch",
+	}
+	require.NoError(t, formatter.Format(files, false, dir, ioutil.Discard))
+
+	// files are not modified
+	got, err := ioutil.ReadFile(files[1])
+	require.NoError(t, err)
+	assert.Equal(t, unformattedSrc, string(got))
+
+	gotPatch, err := ioutil.ReadFile(filepath.Join(dir, "gofmt.patch"))
+	require.NoError(t, err)
+	assert.Equal(t, `diff --git a/pkg/unformatted.go b/pkg/unformatted.go
+--- a/pkg/unformatted.go
++++ b/pkg/unformatted.go
+@@ -1,11 +1,11 @@
+ package foo
+ 
+ import (
+-	_ "os"
+ 	_ "fmt"
++	_ "os"
+ )
+ 
+ func Foo() {
+-	for _ = range []string{} {
++	for range []string{} {
+ 	}
+ }
+`, string(gotPatch))
+
+	// patch can be applied by "git apply" from the project directory
+	cmd := exec.Command("git", "apply", "gofmt.patch")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "%s", string(output))
+	got, err = ioutil.ReadFile(files[1])
+	require.NoError(t, err)
+	assert.Equal(t, formattedSrc, string(got))
+}
+
+func TestFormatWritesPatchFileInRepositorySubdirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	outsideDir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(outsideDir)
+	}()
+
+	writeFile := func(path, src string) string {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(src), 0644))
+		return path
+	}
+	readFile := func(path string) string {
+		content, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		return string(content)
+	}
+	runGit := func(dir string, args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, "%s", string(output))
+	}
+
+	projectDir := filepath.Join(dir, "project")
+	inProject := writeFile(filepath.Join(projectDir, "pkg", "unformatted.go"), unformattedSrc)
+	inRepository := writeFile(filepath.Join(dir, "other", "unformatted.go"), unformattedSrc)
+	runGit(dir, "init")
+	runGit(dir, "add", ".")
+	runGit(dir, "commit", "-m", "base")
+
+	formatter := &gofmt.Formatter{
+		PatchFile: "gofmt.patch",
+	}
+	require.NoError(t, formatter.Format([]string{inProject, inRepository}, false, projectDir, ioutil.Discard))
+
+	// paths are relative to the top-level directory of the repository
+	gotPatch := readFile(filepath.Join(projectDir, "gofmt.patch"))
+	assert.Contains(t, gotPatch, "diff --git a/project/pkg/unformatted.go b/project/pkg/unformatted.go\n--- a/project/pkg/unformatted.go\n+++ b/project/pkg/unformatted.go\n")
+	assert.Contains(t, gotPatch, "diff --git a/other/unformatted.go b/other/unformatted.go\n--- a/other/unformatted.go\n+++ b/other/unformatted.go\n")
+
+	// "git apply" from the project directory applies the changes to the files in it
+	runGit(projectDir, "apply", "gofmt.patch")
+	assert.Equal(t, formattedSrc, readFile(inProject))
+	assert.Equal(t, unformattedSrc, readFile(inRepository))
+
+	// "git apply" from the top-level directory applies all of the changes
+	runGit(dir, "checkout", "--", ".")
+	runGit(dir, "apply", filepath.Join("project", "gofmt.patch"))
+	assert.Equal(t, formattedSrc, readFile(inProject))
+	assert.Equal(t, formattedSrc, readFile(inRepository))
+
+	// the project directory may be relative to the working directory while the files are absolute
+	runGit(dir, "checkout", "--", ".")
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	relProjectDir, err := filepath.Rel(wd, projectDir)
+	require.NoError(t, err)
+	require.NoError(t, formatter.Format([]string{inProject}, false, relProjectDir, ioutil.Discard))
+	assert.Contains(t, readFile(filepath.Join(projectDir, "gofmt.patch")), "diff --git a/project/pkg/unformatted.go b/project/pkg/unformatted.go\n")
+
+	// changes to files outside of the repository cannot be added to the patch
+	outside := writeFile(filepath.Join(outsideDir, "unformatted.go"), unformattedSrc)
+	err = formatter.Format([]string{outside}, false, projectDir, ioutil.Discard)
+	assert.EqualError(t, err, fmt.Sprintf("failed to format 1 file(s):\n%s: cannot be added to the patch because it is outside of the git repository", outside))
+}
+
+func TestFormatChangedSince(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	writeFile := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(src), 0644))
+		return path
+	}
+	runGit := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, "%s", string(output))
+	}
+
+	unchanged := writeFile("unchanged.go", unformattedSrc)
+	modified := writeFile("modified.go", formattedSrc)
+	writeFile("deleted.go", formattedSrc)
+	partial := writeFile("partial.go", unformattedSrc)
+	writeFile("with space.go", unformattedSrc)
+	mode := writeFile("mode.go", unformattedSrc)
+	writeFile("comment.go", unformattedSrc)
+	runGit("init")
+	runGit("add", ".")
+	runGit("commit", "-m", "base")
+	runGit("tag", "base")
+
+	writeFile("modified.go", unformattedSrc)
+	untracked := writeFile("untracked.go", unformattedSrc)
+	require.NoError(t, os.Remove(filepath.Join(dir, "deleted.go")))
+
+	formatter := &gofmt.Formatter{
+		ChangedSince: "base",
+	}
+	buf := &bytes.Buffer{}
+	require.NoError(t, formatter.Format([]string{modified, unchanged, untracked}, true, dir, buf))
+	assert.Equal(t, listedUnformatted(modified)+listedUnformatted(untracked), buf.String())
+
+	// only the changes that overlap the changed line are applied regardless of the configured diff prefixes
+	runGit("config", "diff.mnemonicPrefix", "true")
+	writeFile("partial.go", strings.Replace(unformattedSrc, "package foo", "package  foo", 1))
+	formatter.ChangedLinesOnly = true
+	require.NoError(t, formatter.Format([]string{partial}, false, dir, ioutil.Discard))
+	got, err := ioutil.ReadFile(partial)
+	require.NoError(t, err)
+	assert.Equal(t, unformattedSrc, string(got))
+
+	// files whose names contain spaces, files whose mode is their only change and files with added lines that resemble
+	// the header of a diff are only changed where their lines changed
+	spaced := writeFile("with space.go", strings.Replace(unformattedSrc, "package foo", "package  foo", 1))
+	require.NoError(t, os.Chmod(mode, 0755))
+	commentSrc := strings.Replace(unformattedSrc, "package foo\n", "package foo\n\n/*\n++ b/partial.go\n*/\n", 1)
+	comment := writeFile("comment.go", strings.Replace(commentSrc, ")\n", ")\n\nvar  x = 1\n", 1))
+	require.NoError(t, formatter.Format([]string{spaced, mode, comment}, false, dir, ioutil.Discard))
+	for _, want := range []struct {
+		path string
+		src  string
+	}{
+		{path: spaced, src: unformattedSrc},
+		{path: mode, src: unformattedSrc},
+		{path: comment, src: strings.Replace(commentSrc, ")\n", ")\n\nvar x = 1\n", 1)},
+	} {
+		got, err := ioutil.ReadFile(want.path)
+		require.NoError(t, err)
+		assert.Equal(t, want.src, string(got), "content of %s", want.path)
+	}
+
+	formatter.ChangedSince = "unknown-ref"
+	formatter.ChangedLinesOnly = false
+	err = formatter.Format([]string{modified}, true, dir, ioutil.Discard)
+	assert.EqualError(t, err, fmt.Sprintf(`failed to determine files changed since unknown-ref: "unknown-ref" does not identify a commit in the repository containing %s`, dir))
+}
+
+func TestFormatStaged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	writeFile := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(src), 0644))
+		return path
+	}
+	readFile := func(path string) string {
+		content, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		return string(content)
+	}
+	runGit := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, "%s", string(output))
+		return string(output)
+	}
+
+	runGit("init")
+	partial := writeFile("partial.go", unformattedSrc)
+	full := writeFile("full.go", unformattedSrc)
+	formattedInTree := writeFile("formatted_in_tree.go", unformattedSrc)
+	untracked := writeFile("untracked.go", formattedSrc)
+	runGit("add", "partial.go", "full.go", "formatted_in_tree.go")
+	// the working tree content of partially staged files differs from the staged content
+	writeFile("partial.go", unformattedSrc+"\nvar  x = 1\n")
+	writeFile("formatted_in_tree.go", formattedSrc)
+
+	formatter := &gofmt.Formatter{
+		Staged: true,
+	}
+	buf := &bytes.Buffer{}
+	require.NoError(t, formatter.Format([]string{partial, full, formattedInTree, untracked}, true, dir, buf))
+	assert.Equal(t, listedUnformatted(partial)+listedUnformatted(full)+listedUnformatted(formattedInTree), buf.String())
+
+	formatter.StagedUpdateWorkingTree = true
+	require.NoError(t, formatter.Format([]string{partial, full, formattedInTree, untracked}, false, dir, ioutil.Discard))
+	for _, name := range []string{"partial.go", "full.go", "formatted_in_tree.go"} {
+		assert.Equal(t, formattedSrc, runGit("show", ":"+name), "staged content of %s", name)
+	}
+	// only files whose working tree content is identical to the staged content are updated
+	assert.Equal(t, unformattedSrc+"\nvar  x = 1\n", readFile(partial))
+	assert.Equal(t, formattedSrc, readFile(full))
+	assert.Equal(t, formattedSrc, readFile(formattedInTree))
+
+	buf.Reset()
+	require.NoError(t, formatter.Format([]string{partial, full, formattedInTree, untracked}, true, dir, buf))
+	assert.Equal(t, "", buf.String())
+}
+
+func TestValidate(t *testing.T) {
+	for i, tc := range []struct {
+		name      string
+		formatter gofmt.Formatter
+		wantErr   string
+	}{
+		{
+			name: "staged files",
+			formatter: gofmt.Formatter{
+				Staged: true,
+			},
+		},
+		{
+			name: "staged files cannot be restricted to changed files",
+			formatter: gofmt.Formatter{
+				Staged:       true,
+				ChangedSince: "main",
+			},
+			wantErr: "staged files cannot be restricted to files changed since a commit",
+		},
+		{
+			name: "subprocess with a rewrite rule",
+			formatter: gofmt.Formatter{
+				Subprocess: true,
+				RewriteRules: []gofmt.RewriteRule{
+					mustParseRewriteRule(t, "", "a[0:] -> a"),
+				},
+			},
+		},
+		{
+			name: "staged files cannot be formatted in a subprocess",
+			formatter: gofmt.Formatter{
+				Staged:     true,
+				Subprocess: true,
+			},
+			wantErr: "staged files cannot be formatted in a subprocess",
+		},
+	} {
+		err := tc.formatter.Validate()
+		if tc.wantErr == "" {
+			assert.NoError(t, err, "Case %d: %s", i, tc.name)
+		} else {
+			assert.EqualError(t, err, tc.wantErr, "Case %d: %s", i, tc.name)
+		}
+	}
+}
+
+func TestFormatAppliesOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	src := "package foo\n\nvar s []int\n\nvar _ = s[0:len(s)]\n\nfunc Foo() {\n\tfor _ = range []string{} {\n\t}\n}\n"
+	var files []string
+	for _, name := range []string{"foo.go", "legacy/foo.go", "legacy/keep/foo.go", "internal/foo.go"} {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		require.NoError(t, ioutil.WriteFile(file, []byte(src), 0644))
+		files = append(files, file)
+	}
+	outsideDir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(outsideDir)
+	}()
+	outside := filepath.Join(outsideDir, "vendored", "foo.go")
+	require.NoError(t, os.MkdirAll(filepath.Dir(outside), 0755))
+	require.NoError(t, ioutil.WriteFile(outside, []byte(src), 0644))
+	files = append(files, outside)
+
+	skipSimplify := true
+	formatter := &gofmt.Formatter{
+		Overrides: []gofmt.Override{
+			{
+				Matcher:      matcher.All(matcher.Path("legacy"), matcher.Not(matcher.Path("legacy/keep"))),
+				SkipSimplify: &skipSimplify,
+			},
+			{
+				// files that are not in the project directory are never matched, including by negated matchers
+				Matcher:      matcher.Not(matcher.Any(matcher.Path("foo.go"), matcher.Path("legacy"), matcher.Path("internal"))),
+				SkipSimplify: &skipSimplify,
+			},
+			{
+				Matcher: matcher.Path("internal/*"),
+				RewriteRules: []gofmt.RewriteRule{
+					mustParseRewriteRule(t, "", "a[0:len(a)] -> a"),
+				},
+			},
+		},
+	}
+	require.NoError(t, formatter.Format(files, false, dir, ioutil.Discard))
+
+	simplified := "package foo\n\nvar s []int\n\nvar _ = s[0:]\n\nfunc Foo() {\n\tfor range []string{} {\n\t}\n}\n"
+	for i, want := range []string{
+		simplified,
+		src,
+		simplified,
+		"package foo\n\nvar s []int\n\nvar _ = s\n\nfunc Foo() {\n\tfor range []string{} {\n\t}\n}\n",
+		simplified,
+	} {
+		got, err := ioutil.ReadFile(files[i])
+		require.NoError(t, err)
+		assert.Equal(t, want, string(got), "Case %d: %s", i, files[i])
+	}
+}
+
+func TestFormatBaseline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	writeFile := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(src), 0644))
+		return path
+	}
+	baselined := writeFile("baselined.go", unformattedSrc)
+	changed := writeFile("changed.go", unformattedSrc)
+	fixed := writeFile("fixed.go", unformattedSrc)
+	formatted := writeFile("formatted.go", formattedSrc)
+	files := []string{baselined, changed, fixed, formatted}
+
+	formatter := &gofmt.Formatter{
+		Baseline: "baseline.json",
+	}
+	err = formatter.Format(files, true, dir, ioutil.Discard)
+	assert.EqualError(t, err, fmt.Sprintf("baseline %s does not exist: create it with the baseline command", filepath.Join(dir, "baseline.json")))
+
+	count, err := formatter.UpdateBaseline(files, dir)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	baseline, err := gofmt.ReadBaseline(filepath.Join(dir, "baseline.json"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"baselined.go", "changed.go", "fixed.go"}, sortedKeys(baseline.Files))
+
+	// files in the baseline are only listed once their content changes
+	buf := &bytes.Buffer{}
+	require.NoError(t, formatter.Format(files, true, dir, buf))
+	assert.Equal(t, "", buf.String())
+	writeFile("changed.go", unformattedSrc+"\nvar  x = 1\n")
+	added := writeFile("added.go", unformattedSrc)
+	files = append(files, added)
+	require.NoError(t, formatter.Format(files, true, dir, buf))
+	assert.Equal(t, listedUnformatted(changed)+listedUnformatted(added), buf.String())
+
+	// files that are formatted are removed from the baseline when it is updated
+	writeFile("fixed.go", formattedSrc)
+	count, err = formatter.UpdateBaseline(files, dir)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	baseline, err = gofmt.ReadBaseline(filepath.Join(dir, "baseline.json"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"added.go", "baselined.go", "changed.go"}, sortedKeys(baseline.Files))
+
+	// files in the baseline are formatted
+	require.NoError(t, formatter.Format(files, false, dir, ioutil.Discard))
+	got, err := ioutil.ReadFile(baselined)
+	require.NoError(t, err)
+	assert.Equal(t, formattedSrc, string(got))
+}
+
+// listedUnformatted returns the output of list mode for a file with the content unformattedSrc.
+func listedUnformatted(file string) string {
+	return file + "\n" + file + ": simplification rule \"range\" applied\n"
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func mustParseRewriteRule(t *testing.T, name, rule string) gofmt.RewriteRule {
+	parsed, err := gofmt.ParseRewriteRule(name, rule)
+	require.NoError(t, err)
+	return parsed
+}
@@ -0,0 +1,176 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hook installs and uninstalls a git pre-commit hook that verifies that the Go files that are staged for commit
+// are formatted.
+package hook
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/internal/git"
+)
+
+const (
+	// Name is the name of the hook that is installed.
+	Name = "pre-commit"
+	// ChainedName is the name to which an existing pre-commit hook is renamed when the hook is installed. The chained
+	// hook is run before the check and is restored when the hook is uninstalled.
+	ChainedName = Name + ".chained-by-gofmt"
+
+	// marker identifies hooks that were installed by Install.
+	marker = "# godel-format-asset-gofmt pre-commit hook"
+)
+
+// Install installs a pre-commit hook in the repository that contains projectDir that runs the asset at assetPath with
+// the provided formatter configuration to verify that the content of the Go files in projectDir that is staged for
+// commit is formatted. If a pre-commit hook that was not installed by Install already exists, it is renamed to
+// ChainedName and run by the installed hook before the check. If the hook is already installed, it is replaced.
+// Returns the path of the installed hook.
+func Install(projectDir, assetPath, cfgYML string) (string, error) {
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to determine absolute path of %q", projectDir)
+	}
+	hooksDir, err := git.HooksDir(dir)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to determine git hooks directory")
+	}
+	hookPath := filepath.Join(hooksDir, Name)
+	chainedPath := filepath.Join(hooksDir, ChainedName)
+
+	installed, err := isInstalled(hookPath)
+	if err != nil {
+		return "", err
+	}
+	if !installed {
+		if _, err := os.Stat(hookPath); err == nil {
+			if _, err := os.Stat(chainedPath); err == nil {
+				return "", errors.Errorf("cannot chain existing hook %s because %s already exists", hookPath, chainedPath)
+			}
+			if err := os.Rename(hookPath, chainedPath); err != nil {
+				return "", errors.Wrapf(err, "failed to rename existing hook %s", hookPath)
+			}
+		} else if !os.IsNotExist(err) {
+			return "", errors.Wrapf(err, "failed to stat %s", hookPath)
+		}
+	}
+
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return "", errors.Wrapf(err, "failed to create directory %s", hooksDir)
+	}
+	if err := ioutil.WriteFile(hookPath, []byte(script(dir, assetPath, cfgYML, chainedPath)), 0755); err != nil {
+		return "", errors.Wrapf(err, "failed to write hook %s", hookPath)
+	}
+	// WriteFile does not change the mode of an existing file
+	if err := os.Chmod(hookPath, 0755); err != nil {
+		return "", errors.Wrapf(err, "failed to make hook %s executable", hookPath)
+	}
+	return hookPath, nil
+}
+
+// Uninstall removes the pre-commit hook installed by Install from the repository that contains projectDir and
+// restores the hook that it chained, if any. Returns the path of the removed hook, or an empty string if the hook is
+// not installed. Returns an error if the pre-commit hook was not installed by Install.
+func Uninstall(projectDir string) (string, error) {
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to determine absolute path of %q", projectDir)
+	}
+	hooksDir, err := git.HooksDir(dir)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to determine git hooks directory")
+	}
+	hookPath := filepath.Join(hooksDir, Name)
+	chainedPath := filepath.Join(hooksDir, ChainedName)
+
+	if _, err := os.Stat(hookPath); os.IsNotExist(err) {
+		return "", nil
+	}
+	installed, err := isInstalled(hookPath)
+	if err != nil {
+		return "", err
+	}
+	if !installed {
+		return "", errors.Errorf("hook %s was not installed by the gofmt asset", hookPath)
+	}
+	if err := os.Remove(hookPath); err != nil {
+		return "", errors.Wrapf(err, "failed to remove hook %s", hookPath)
+	}
+	if _, err := os.Stat(chainedPath); err == nil {
+		if err := os.Rename(chainedPath, hookPath); err != nil {
+			return "", errors.Wrapf(err, "failed to restore chained hook %s", chainedPath)
+		}
+	}
+	return hookPath, nil
+}
+
+// isInstalled returns true if the file at hookPath exists and is a hook that was installed by Install.
+func isInstalled(hookPath string) (bool, error) {
+	content, err := ioutil.ReadFile(hookPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to read hook %s", hookPath)
+	}
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		if string(bytes.TrimSpace(line)) == marker {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// script returns the content of the hook. The hook runs the chained hook if it exists and then lists the staged Go
+// files in projectDir whose staged content is not formatted. Files in vendor directories are not checked. The commit
+// is rejected if any files are listed or the check fails.
+func script(projectDir, assetPath, cfgYML, chainedPath string) string {
+	return fmt.Sprintf(`#!/bin/sh
+%s
+# Verifies that the content of the Go files that is staged for commit is formatted. Remove this hook by running
+# "%s uninstall-hook".
+
+chained=%s
+if [ -x "$chained" ]; then
+	"$chained" "$@" || exit $?
+fi
+
+unformatted=$(git diff --cached --name-only --diff-filter=ACMR -z -- '*.go' ':(exclude,glob)**/vendor/**' |
+	xargs -0 %s run-format --staged --list --config-yml %s --project-dir %s)
+status=$?
+if [ -n "$unformatted" ]; then
+	echo "The staged content of the following files is not formatted:" >&2
+	echo "$unformatted" >&2
+	echo "Format the files and stage the changes before committing." >&2
+	exit 1
+fi
+if [ $status -ne 0 ]; then
+	echo "Failed to verify that staged files are formatted." >&2
+	exit $status
+fi
+`, marker, assetPath, quote(chainedPath), quote(assetPath), quote(cfgYML), quote(projectDir))
+}
+
+// quote returns s quoted as a single word for the shell.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
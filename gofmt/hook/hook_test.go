@@ -0,0 +1,87 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hook_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/hook"
+)
+
+func TestInstallAndUninstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	runGit := func(args ...string) (string, error) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	}
+	writeFile := func(path, content string, perm os.FileMode) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), perm))
+	}
+
+	_, err = runGit("init")
+	require.NoError(t, err)
+	hookPath := filepath.Join(dir, ".git", "hooks", hook.Name)
+	existingHook := "#!/bin/sh\necho existing hook ran\n"
+	writeFile(hookPath, existingHook, 0755)
+
+	// the asset lists the files that it is provided
+	assetPath := filepath.Join(dir, "asset")
+	writeFile(assetPath, "#!/bin/sh\nfor arg; do case $arg in *.go) echo $arg;; esac; done\n", 0755)
+
+	installedPath, err := hook.Install(dir, assetPath, "")
+	require.NoError(t, err)
+	assert.Equal(t, hookPath, installedPath)
+	// installing again replaces the installed hook without chaining it
+	_, err = hook.Install(dir, assetPath, "")
+	require.NoError(t, err)
+
+	writeFile(filepath.Join(dir, "foo.go"), "package foo\n", 0644)
+	writeFile(filepath.Join(dir, "README"), "", 0644)
+	_, err = runGit("add", ".")
+	require.NoError(t, err)
+	output, err := runGit("commit", "-m", "unformatted")
+	require.Error(t, err)
+	assert.Equal(t, "existing hook ran\nThe staged content of the following files is not formatted:\nfoo.go\nFormat the files and stage the changes before committing.\n", output)
+
+	removedPath, err := hook.Uninstall(dir)
+	require.NoError(t, err)
+	assert.Equal(t, hookPath, removedPath)
+	restored, err := ioutil.ReadFile(hookPath)
+	require.NoError(t, err)
+	assert.Equal(t, existingHook, string(restored))
+	_, err = os.Stat(filepath.Join(dir, ".git", "hooks", hook.ChainedName))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = hook.Uninstall(dir)
+	assert.EqualError(t, err, "hook "+hookPath+" was not installed by the gofmt asset")
+	require.NoError(t, os.Remove(hookPath))
+	removedPath, err = hook.Uninstall(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "", removedPath)
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache provides a persistent record of file contents that are known to be formatted.
+//
+// Entries are keyed on the SHA-256 hash of the file content combined with a key for the formatter configuration and
+// are stored as empty files in a directory specific to the asset executable that created them, so changing the asset
+// binary invalidates all existing entries. The cache directory can be deleted at any time and multiple processes may
+// use the same directory concurrently.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/palantir/godel/v2/framework/builtintasks/installupdate/layout"
+	"github.com/pkg/errors"
+)
+
+const (
+	assetCacheDirName = "gofmt-asset"
+	// maxUnusedAge is the duration after which the directory of an executable that has not been used is removed. The
+	// directories of other executables are kept for a while since several versions of the asset may be in use at the
+	// same time, such as by projects that use different versions of gödel.
+	maxUnusedAge = 30 * 24 * time.Hour
+)
+
+// DefaultDir returns the default cache directory, which is a directory within the gödel home cache directory.
+func DefaultDir() (string, error) {
+	godelHome, err := layout.GodelHomePath()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to determine gödel home directory")
+	}
+	return filepath.Join(godelHome, layout.CacheDir, assetCacheDirName), nil
+}
+
+type Cache struct {
+	dir    string
+	cfgKey []byte
+}
+
+// New returns a Cache that stores its entries in a directory within dir that is specific to the currently running
+// executable. cfgKey should uniquely identify the configuration used to format files. Directories for other
+// executables that have not been used for 30 days are removed on a best-effort basis.
+func New(dir string, cfgKey []byte) (*Cache, error) {
+	exeHash, err := executableHash()
+	if err != nil {
+		return nil, err
+	}
+	exeDir := filepath.Join(dir, exeHash)
+	// the modification time of the directory records when it was last used
+	now := time.Now()
+	_ = os.Chtimes(exeDir, now, now)
+	pruneDirs(dir, exeHash, now.Add(-maxUnusedAge))
+	return &Cache{
+		dir:    exeDir,
+		cfgKey: cfgKey,
+	}, nil
+}
+
+// Formatted returns true if the provided content was previously recorded as formatted.
+func (c *Cache) Formatted(src []byte) bool {
+	_, err := os.Stat(c.entryPath(src))
+	return err == nil
+}
+
+// SetFormatted records that the provided content is formatted. Failures are ignored since the cache is only an
+// optimization.
+func (c *Cache) SetFormatted(src []byte) {
+	entryPath := c.entryPath(src)
+	if err := os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return
+	}
+	// entries are empty, so concurrent creation of the same entry is benign
+	if f, err := os.OpenFile(entryPath, os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+		_ = f.Close()
+	}
+}
+
+func (c *Cache) entryPath(src []byte) string {
+	srcHash := sha256.Sum256(src)
+	h := sha256.New()
+	_, _ = h.Write(c.cfgKey)
+	_, _ = h.Write(srcHash[:])
+	key := hex.EncodeToString(h.Sum(nil))
+	return filepath.Join(c.dir, key[:2], key[2:])
+}
+
+var executable struct {
+	once sync.Once
+	hash string
+	err  error
+}
+
+// executableHash returns the hash of the currently running executable. The executable is only hashed once per
+// process.
+func executableHash() (string, error) {
+	executable.once.Do(func() {
+		executable.hash, executable.err = hashExecutable()
+	})
+	return executable.hash, executable.err
+}
+
+func hashExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to determine executable")
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open executable")
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "failed to hash executable")
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// pruneDirs removes the directories in dir other than the one for the current executable that were last used before
+// cutoff.
+func pruneDirs(dir, exeHash string, cutoff time.Time) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, fi := range fis {
+		if fi.IsDir() && fi.Name() != exeHash && fi.ModTime().Before(cutoff) {
+			_ = os.RemoveAll(filepath.Join(dir, fi.Name()))
+		}
+	}
+}
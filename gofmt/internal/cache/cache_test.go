@@ -0,0 +1,70 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/internal/cache"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	// directories for other executables are pruned once they have not been used for 30 days
+	staleDir := filepath.Join(dir, "stale")
+	require.NoError(t, os.Mkdir(staleDir, 0755))
+	lastUsed := time.Now().Add(-31 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(staleDir, lastUsed, lastUsed))
+	recentDir := filepath.Join(dir, "recent")
+	require.NoError(t, os.Mkdir(recentDir, 0755))
+	lastUsed = time.Now().Add(-29 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(recentDir, lastUsed, lastUsed))
+
+	c, err := cache.New(dir, []byte("simplify"))
+	require.NoError(t, err)
+	_, err = os.Stat(staleDir)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(recentDir)
+	assert.NoError(t, err)
+
+	src := []byte("package foo\n")
+	assert.False(t, c.Formatted(src))
+	c.SetFormatted(src)
+	assert.True(t, c.Formatted(src))
+	assert.False(t, c.Formatted([]byte("package bar\n")))
+
+	// entries are specific to the configuration key
+	otherCfg, err := cache.New(dir, []byte("no-simplify"))
+	require.NoError(t, err)
+	assert.False(t, otherCfg.Formatted(src))
+
+	// deleting the cache directory removes all entries
+	require.NoError(t, os.RemoveAll(dir))
+	assert.False(t, c.Formatted(src))
+	c.SetFormatted(src)
+	assert.True(t, c.Formatted(src))
+}
@@ -0,0 +1,269 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package git runs git commands against the local repository that contains the files being formatted.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChangedFiles returns the absolute paths of the files in dir and its subdirectories that differ between the working
+// tree and the commit identified by ref, including untracked files that are not ignored. Deleted files are not
+// returned. Only the local repository is consulted: ref is never fetched.
+func ChangedFiles(dir, ref string) ([]string, error) {
+	if err := verifyCommit(dir, ref); err != nil {
+		return nil, err
+	}
+	changed, err := run(dir, "diff", "--name-only", "--relative", "--no-renames", "--diff-filter=d", "-z", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := run(dir, "ls-files", "--others", "--exclude-standard", "-z", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, out := range []string{changed, untracked} {
+		for _, name := range strings.Split(out, "\x00") {
+			if name != "" {
+				files = append(files, filepath.Join(dir, filepath.FromSlash(name)))
+			}
+		}
+	}
+	return files, nil
+}
+
+// LineRange is a range of lines in a file. Lines are numbered from 1 and both Start and End are inclusive.
+type LineRange struct {
+	Start, End int
+}
+
+var hunkHeaderRegexp = regexp.MustCompile(`^@@ -[0-9]+(?:,[0-9]+)? \+([0-9]+)(?:,([0-9]+))? @@`)
+
+// ChangedLines returns the lines of the tracked files in dir and its subdirectories that differ between the working
+// tree and the commit identified by ref, keyed by the absolute path of the file. The lines surrounding lines that were
+// removed are considered changed. Every changed tracked file has an entry, which is empty if no lines of the file
+// changed, such as if only its mode changed. Untracked files are not included.
+func ChangedLines(dir, ref string) (map[string][]LineRange, error) {
+	if err := verifyCommit(dir, ref); err != nil {
+		return nil, err
+	}
+	names, err := run(dir, "diff", "--name-only", "--relative", "--no-renames", "--diff-filter=d", "-z", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[string][]LineRange)
+	for _, name := range strings.Split(names, "\x00") {
+		if name != "" {
+			changed[filepath.Join(dir, filepath.FromSlash(name))] = nil
+		}
+	}
+	// the prefixes are explicit so that the output does not depend on the diff.noprefix and diff.mnemonicPrefix
+	// configuration
+	out, err := run(dir, "diff", "--relative", "--no-renames", "--diff-filter=d", "--no-color", "--no-ext-diff", "--no-textconv", "--src-prefix=a/", "--dst-prefix=b/", "-U0", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+	var file string
+	// inHeader is true between the "diff --git" line that starts the diff of a file and its first hunk: added lines
+	// that start with "++ " would otherwise be mistaken for the name of a file
+	inHeader := false
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(nil, len(out)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "diff --git ") {
+			file, inHeader = "", true
+			continue
+		}
+		if inHeader && strings.HasPrefix(line, "+++ ") {
+			file = filepath.Join(dir, filepath.FromSlash(newFileName(line)))
+			continue
+		}
+		match := hunkHeaderRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		inHeader = false
+		if file == "" {
+			continue
+		}
+		start, _ := strconv.Atoi(match[1])
+		count := 1
+		if match[2] != "" {
+			count, _ = strconv.Atoi(match[2])
+		}
+		lineRange := LineRange{Start: start, End: start + count - 1}
+		if count == 0 {
+			// lines were removed after line start
+			lineRange = LineRange{Start: start, End: start + 1}
+			if lineRange.Start < 1 {
+				lineRange.Start = 1
+			}
+		}
+		changed[file] = append(changed[file], lineRange)
+	}
+	return changed, scanner.Err()
+}
+
+// newFileName returns the path of the file named by the "+++ b/<path>" line of the header of a diff. The path may be
+// quoted if it contains special characters and is followed by a tab if it contains a space.
+func newFileName(line string) string {
+	name := strings.TrimSuffix(strings.TrimPrefix(line, "+++ "), "\t")
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		name = unquoted
+	}
+	return strings.TrimPrefix(name, "b/")
+}
+
+// IndexEntry is an entry of the git index.
+type IndexEntry struct {
+	// Mode is the octal mode of the entry, such as "100644".
+	Mode string
+	// Object is the name of the blob that holds the staged content of the file.
+	Object string
+	// Stage is the merge stage of the entry, which is non-zero if the file has unresolved conflicts.
+	Stage int
+	// Path is the path of the file relative to the directory in which the index was read.
+	Path string
+}
+
+// Regular returns true if the entry is a regular file rather than a symbolic link or submodule.
+func (e IndexEntry) Regular() bool {
+	return e.Mode == "100644" || e.Mode == "100755"
+}
+
+// IndexEntries returns the entries of the index of the repository that contains dir for the files in dir and its
+// subdirectories, keyed by the absolute path of the file. If a file has unresolved conflicts, one of its entries with a
+// non-zero stage is returned.
+func IndexEntries(dir string) (map[string]IndexEntry, error) {
+	out, err := run(dir, "ls-files", "--stage", "-z", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]IndexEntry)
+	for _, line := range strings.Split(out, "\x00") {
+		if line == "" {
+			continue
+		}
+		// each entry is of the form "<mode> <object> <stage>\t<path>"
+		tab := strings.IndexByte(line, '\t')
+		if tab < 0 {
+			return nil, errors.Errorf("unexpected index entry %q", line)
+		}
+		fields := strings.Fields(line[:tab])
+		if len(fields) != 3 {
+			return nil, errors.Errorf("unexpected index entry %q", line)
+		}
+		stage, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, errors.Errorf("unexpected index entry %q", line)
+		}
+		entry := IndexEntry{
+			Mode:   fields[0],
+			Object: fields[1],
+			Stage:  stage,
+			Path:   line[tab+1:],
+		}
+		entries[filepath.Join(dir, filepath.FromSlash(entry.Path))] = entry
+	}
+	return entries, nil
+}
+
+// ReadBlob returns the content of the blob with the provided name in the repository that contains dir.
+func ReadBlob(dir, object string) ([]byte, error) {
+	out, err := run(dir, "cat-file", "blob", object)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+// WriteBlob writes content as a blob to the object database of the repository that contains dir and returns its name.
+// No filters are applied to the content.
+func WriteBlob(dir string, content []byte) (string, error) {
+	out, err := runWithInput(dir, content, "hash-object", "-w", "--stdin")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// UpdateIndex sets the index entry for the path of entry, which is relative to dir, to the mode and object of entry.
+func UpdateIndex(dir string, entry IndexEntry) error {
+	_, err := run(dir, "update-index", "--cacheinfo", entry.Mode+","+entry.Object+","+entry.Path)
+	return err
+}
+
+// HooksDir returns the absolute path of the directory that contains the hooks of the repository that contains dir,
+// taking the core.hooksPath configuration into account.
+func HooksDir(dir string) (string, error) {
+	out, err := run(dir, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	hooksDir := filepath.FromSlash(strings.TrimSpace(out))
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(dir, hooksDir)
+	}
+	return hooksDir, nil
+}
+
+// Prefix returns the path of dir relative to the top-level directory of the working tree of the git repository that
+// contains it. The path uses forward slashes and ends with a slash unless dir is the top-level directory, in which
+// case it is empty.
+func Prefix(dir string) (string, error) {
+	out, err := run(dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(out, "\n"), nil
+}
+
+// verifyCommit returns an error if ref does not identify a commit in the repository that contains dir.
+func verifyCommit(dir, ref string) error {
+	if _, err := run(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+		return errors.Errorf("%q does not identify a commit in the repository containing %s", ref, dir)
+	}
+	return nil
+}
+
+// run runs git with the provided arguments in dir and returns its standard output.
+func run(dir string, args ...string) (string, error) {
+	return runWithInput(dir, nil, args...)
+}
+
+// runWithInput runs git with the provided arguments in dir with stdin as its standard input and returns its standard
+// output.
+func runWithInput(dir string, stdin []byte, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
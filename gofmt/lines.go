@@ -0,0 +1,110 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	amalgomatedformatter "github.com/palantir/godel-format-asset-gofmt/generated_src"
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/internal/git"
+)
+
+// LineRange is a range of lines in a file. Lines are numbered from 1 and both Start and End are inclusive.
+type LineRange = amalgomatedformatter.LineRange
+
+// ParseLineRange parses a line range of the form "<start>-<end>" or "<line>".
+func ParseLineRange(s string) (LineRange, error) {
+	parts := strings.SplitN(s, "-", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil || start < 1 {
+		return LineRange{}, errors.Errorf("invalid line range %q: lines must be positive integers", s)
+	}
+	end := start
+	if len(parts) == 2 {
+		if end, err = strconv.Atoi(parts[1]); err != nil || end < start {
+			return LineRange{}, errors.Errorf("invalid line range %q: end must be an integer that is not less than start", s)
+		}
+	}
+	return LineRange{Start: start, End: end}, nil
+}
+
+// ParseFileLineRanges parses the line ranges of a file specified as "<path>:<range>[,<range>...]", where each range is
+// of the form accepted by ParseLineRange.
+func ParseFileLineRanges(s string) (string, []LineRange, error) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return "", nil, errors.Errorf("invalid file line ranges %q: must be of the form <path>:<range>[,<range>...]", s)
+	}
+	var ranges []LineRange
+	for _, rangeStr := range strings.Split(s[i+1:], ",") {
+		lineRange, err := ParseLineRange(rangeStr)
+		if err != nil {
+			return "", nil, err
+		}
+		ranges = append(ranges, lineRange)
+	}
+	return s[:i], ranges, nil
+}
+
+// lineRangesFunc returns the function that provides the line ranges to which formatting is restricted, or nil if
+// formatting is not restricted.
+func (f *Formatter) lineRangesFunc(projectDir string) (func(filename string) ([]LineRange, bool), error) {
+	if !f.ChangedLinesOnly && len(f.LineRanges) == 0 {
+		return nil, nil
+	}
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to determine absolute path of %q", projectDir)
+	}
+	ranges := make(map[string][]LineRange)
+	for path, fileRanges := range f.LineRanges {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		ranges[filepath.Clean(path)] = append(ranges[filepath.Clean(path)], fileRanges...)
+	}
+	if f.ChangedLinesOnly {
+		if f.ChangedSince == "" {
+			return nil, errors.Errorf("formatting can only be restricted to changed lines if changed-since is specified")
+		}
+		changedLines, err := git.ChangedLines(dir, f.ChangedSince)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to determine lines changed since %s", f.ChangedSince)
+		}
+		for path, fileRanges := range changedLines {
+			// changed files without changed lines have an empty entry so that they are left unchanged
+			if _, ok := ranges[path]; !ok {
+				ranges[path] = nil
+			}
+			for _, r := range fileRanges {
+				ranges[path] = append(ranges[path], LineRange{Start: r.Start, End: r.End})
+			}
+		}
+	}
+	return func(filename string) ([]LineRange, bool) {
+		absFilename, err := filepath.Abs(filename)
+		if err != nil {
+			return nil, false
+		}
+		// files without ranges are formatted entirely: when restricting formatting to changed lines, the only such
+		// files that are formatted are untracked, so all of their lines are changed
+		fileRanges, ok := ranges[absFilename]
+		return fileRanges, ok
+	}, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/palantir/pkg/matcher"
+	"github.com/pkg/errors"
+
+	amalgomatedformatter "github.com/palantir/godel-format-asset-gofmt/generated_src"
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/internal/cache"
+)
+
+// Override customizes the formatting of the files that it matches.
+type Override struct {
+	// Matcher matches the paths of the files to which the override applies relative to the project directory. Files
+	// that are not in the project directory are never matched.
+	Matcher matcher.Matcher
+	// SkipSimplify, if non-nil, replaces the SkipSimplify setting of the Formatter.
+	SkipSimplify *bool
+	// SkipSimplifyRules, if non-nil, replaces the SkipSimplifyRules setting of the Formatter.
+	SkipSimplifyRules []string
+	// ExtraSimplifyRules, if non-nil, replaces the ExtraSimplifyRules setting of the Formatter.
+	ExtraSimplifyRules []string
+	// RewriteRules are applied after the rewrite rules of the Formatter and of the overrides before this one.
+	RewriteRules []RewriteRule
+	// Generated, if non-empty, replaces the Generated setting of the Formatter.
+	Generated GeneratedPolicy
+}
+
+// fileSettings are the settings used to format a file: the settings of the Formatter with the overrides that match the
+// file applied.
+type fileSettings struct {
+	opts      amalgomatedformatter.Options
+	generated GeneratedPolicy
+	// cache is the cache of files that are known to be formatted with opts. Nil if no cache is used.
+	cache *cache.Cache
+}
+
+// modifiable returns true if the file of the provided result may be modified by formatting.
+func (s *fileSettings) modifiable(result amalgomatedformatter.Result) bool {
+	return !result.Generated || s.generated != GeneratedVerifyOnly
+}
+
+// fileSettings returns the settings for each of the provided files keyed by the name with which it was provided. Files
+// that match the same overrides share settings. lineRanges is the function that restricts formatting to lines, or nil
+// if formatting is not restricted, in which case the settings use a cache if the Formatter has a cache directory.
+func (f *Formatter) fileSettings(files []string, projectDir string, lineRanges func(filename string) ([]LineRange, bool)) (map[string]*fileSettings, error) {
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to determine absolute path of %q", projectDir)
+	}
+	// settings keyed by the indexes of the overrides that they apply
+	settingsByOverrides := make(map[string]*fileSettings)
+	settings := make(map[string]*fileSettings, len(files))
+	for _, file := range files {
+		var key strings.Builder
+		var overrides []Override
+		if len(f.Overrides) > 0 {
+			absFile, err := filepath.Abs(file)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to determine absolute path of %q", file)
+			}
+			// files that are not in the project directory are never matched
+			relPath, err := filepath.Rel(dir, absFile)
+			if err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+				for i, override := range f.Overrides {
+					if override.Matcher != nil && override.Matcher.Match(filepath.ToSlash(relPath)) {
+						_, _ = fmt.Fprintf(&key, "%d,", i)
+						overrides = append(overrides, override)
+					}
+				}
+			}
+		}
+		fileSettings, ok := settingsByOverrides[key.String()]
+		if !ok {
+			fileSettings = f.newFileSettings(overrides, lineRanges)
+			settingsByOverrides[key.String()] = fileSettings
+		}
+		settings[file] = fileSettings
+	}
+	return settings, nil
+}
+
+// newFileSettings returns the settings of the Formatter with the provided overrides applied in order.
+func (f *Formatter) newFileSettings(overrides []Override, lineRanges func(filename string) ([]LineRange, bool)) *fileSettings {
+	skipSimplify := f.SkipSimplify
+	skipSimplifyRules := f.SkipSimplifyRules
+	extraSimplifyRules := f.ExtraSimplifyRules
+	rewriteRules := f.RewriteRules
+	generated := f.Generated
+	for _, override := range overrides {
+		if override.SkipSimplify != nil {
+			skipSimplify = *override.SkipSimplify
+		}
+		if override.SkipSimplifyRules != nil {
+			skipSimplifyRules = override.SkipSimplifyRules
+		}
+		if override.ExtraSimplifyRules != nil {
+			extraSimplifyRules = override.ExtraSimplifyRules
+		}
+		if len(override.RewriteRules) > 0 {
+			rewriteRules = append(append([]RewriteRule(nil), rewriteRules...), override.RewriteRules...)
+		}
+		if override.Generated != "" {
+			generated = override.Generated
+		}
+	}
+	settings := &fileSettings{
+		opts: amalgomatedformatter.Options{
+			Simplify:        !skipSimplify || len(extraSimplifyRules) > 0,
+			Simplifications: simplifyRules(skipSimplify, skipSimplifyRules, extraSimplifyRules),
+			RewriteRules:    rewriteRules,
+			SkipGenerated:   generated == GeneratedSkip,
+		},
+		generated: generated,
+	}
+	if lineRanges != nil {
+		// files that are unchanged when formatting is restricted to lines may still not be formatted, so they
+		// cannot be cached
+		settings.opts.Lines = lineRanges
+	} else if settings.cache = f.newCache(settings.opts); settings.cache != nil {
+		settings.opts.Formatted = settings.cache.Formatted
+	}
+	return settings
+}
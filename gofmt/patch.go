@@ -0,0 +1,98 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	amalgomatedformatter "github.com/palantir/godel-format-asset-gofmt/generated_src"
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/internal/git"
+)
+
+// patch accumulates the changes to files in the format of "git diff" so that they can be applied with "git apply".
+type patch struct {
+	// prefix is the path of the project directory relative to the directory against which the paths in the patch are
+	// resolved, which is the top-level directory of the git repository that contains the project directory.
+	prefix string
+	// root describes the directory against which the paths in the patch are resolved.
+	root string
+	buf  bytes.Buffer
+}
+
+// newPatch returns an empty patch for the files in projectDir. If projectDir is not in a git repository, the paths in
+// the patch are relative to projectDir.
+func newPatch(projectDir string) *patch {
+	prefix, err := git.Prefix(projectDir)
+	if err != nil {
+		return &patch{
+			root: projectDir,
+		}
+	}
+	return &patch{
+		prefix: prefix,
+		root:   "the git repository",
+	}
+}
+
+// add adds the changes in the provided result to the patch. Files are identified by their path relative to the
+// top-level directory of the repository, which is how "git apply" resolves them regardless of the directory from which
+// it is run. Both projectDir and the file name may be relative to the working directory. Returns an error if the file
+// is outside of that directory.
+func (p *patch) add(result amalgomatedformatter.Result, projectDir string) error {
+	absProjectDir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to determine absolute path of %s", projectDir)
+	}
+	absFile, err := filepath.Abs(result.Filename)
+	if err != nil {
+		return errors.Wrapf(err, "failed to determine absolute path of %s", result.Filename)
+	}
+	rel, err := filepath.Rel(absProjectDir, absFile)
+	if err == nil {
+		rel = path.Clean(p.prefix + filepath.ToSlash(rel))
+	}
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return errors.Errorf("cannot be added to the patch because it is outside of %s", p.root)
+	}
+	diff := amalgomatedformatter.UnifiedDiff("a/"+rel, "b/"+rel, result.Src, result.Formatted, amalgomatedformatter.DefaultDiffContext)
+	if diff == nil {
+		return nil
+	}
+	_, _ = fmt.Fprintf(&p.buf, "diff --git a/%s b/%s\n", rel, rel)
+	_, _ = p.buf.Write(diff)
+	return nil
+}
+
+// write writes the patch to the file at path. A relative path is resolved against projectDir. If the patch contains
+// no changes, the file is empty.
+func (p *patch) write(path, projectDir string) error {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(projectDir, path)
+	}
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(p.buf.Bytes())
+		return err
+	}); err != nil {
+		return errors.Wrapf(err, "failed to write patch %s", path)
+	}
+	return nil
+}
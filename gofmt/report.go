@@ -0,0 +1,193 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	amalgomatedformatter "github.com/palantir/godel-format-asset-gofmt/generated_src"
+)
+
+// FileStatus is the outcome of formatting a single file.
+type FileStatus string
+
+const (
+	// StatusFormatted indicates that the file is formatted.
+	StatusFormatted FileStatus = "formatted"
+	// StatusChanged indicates that formatting changes the file. In list mode the file is not modified.
+	StatusChanged FileStatus = "changed"
+	// StatusError indicates that the file could not be formatted.
+	StatusError FileStatus = "error"
+	// StatusBaselined indicates that formatting changes the file but the file was not listed because it is in the
+	// baseline. Files are only baselined in list mode.
+	StatusBaselined FileStatus = "baselined"
+	// StatusSkipped indicates that the file was not formatted because it is generated and generated files are skipped.
+	StatusSkipped FileStatus = "skipped"
+)
+
+// Report is the outcome of a single Format operation.
+type Report struct {
+	Files []FileReport
+}
+
+// FileReport is the outcome of formatting a single file.
+type FileReport struct {
+	// Path is the path of the file relative to the project directory, or the path of the file as provided if it is
+	// not in the project directory. Always uses the slash separator.
+	Path   string
+	Status FileStatus
+	// Generated is true if the file is generated.
+	Generated bool
+	// Hunks are the hunks of the diff between the original and formatted content. Only set for changed files.
+	Hunks []amalgomatedformatter.DiffHunk
+	// RewriteRules are the names of the rewrite rules whose patterns matched the file.
+	RewriteRules []string
+	// Simplifications are the names of the simplifications that changed the file.
+	Simplifications []string
+	// Errors are the errors that occurred while formatting the file. Only set if Status is StatusError.
+	Errors []FileError
+}
+
+// Identifiers of the kinds of problems in reports.
+const (
+	unformattedRuleID = "gofmt/unformatted"
+	parseErrorRuleID  = "gofmt/parse-error"
+)
+
+// changeMessage returns a message that describes the provided change.
+func changeMessage(c change) string {
+	switch {
+	case len(c.removed) == 0:
+		return fmt.Sprintf("gofmt inserts %d line(s) before line %d.", len(c.added), c.startLine)
+	case c.startLine == c.endLine():
+		return fmt.Sprintf("Line %d is not formatted with gofmt.", c.startLine)
+	default:
+		return fmt.Sprintf("Lines %d-%d are not formatted with gofmt.", c.startLine, c.endLine())
+	}
+}
+
+// change is a contiguous run of removed and added lines in a diff.
+type change struct {
+	// startLine is the 1-based number of the first removed line in the original content or, if no lines are removed,
+	// of the line before which lines are added.
+	startLine int
+	// removed and added are the removed and added lines without line terminators.
+	removed, added []string
+}
+
+// endLine returns the number of the last removed line, or startLine if no lines are removed.
+func (c change) endLine() int {
+	if len(c.removed) == 0 {
+		return c.startLine
+	}
+	return c.startLine + len(c.removed) - 1
+}
+
+// changes returns the changes in the provided hunks in order.
+func changes(hunks []amalgomatedformatter.DiffHunk) []change {
+	var changes []change
+	for _, hunk := range hunks {
+		line := hunk.OldStart
+		if hunk.OldLines == 0 {
+			// an empty range starts after the line in the header
+			line++
+		}
+		var current *change
+		for _, hunkLine := range hunk.Lines {
+			if hunkLine == "" || hunkLine[0] == '\\' {
+				continue
+			}
+			if hunkLine[0] == ' ' {
+				current = nil
+				line++
+				continue
+			}
+			if current == nil {
+				changes = append(changes, change{startLine: line})
+				current = &changes[len(changes)-1]
+			}
+			if hunkLine[0] == '-' {
+				current.removed = append(current.removed, hunkLine[1:])
+				line++
+			} else {
+				current.added = append(current.added, hunkLine[1:])
+			}
+		}
+	}
+	return changes
+}
+
+// fileDiff returns the unified diff of the changes to the provided file.
+func fileDiff(file FileReport) string {
+	if len(file.Hunks) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "--- %s.orig\n+++ %s\n", file.Path, file.Path)
+	for _, hunk := range file.Hunks {
+		sb.WriteString(hunk.Header())
+		sb.WriteString("\n")
+		for _, line := range hunk.Lines {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// reportPath returns the path of filename as it is reported.
+func reportPath(filename, projectDir string) string {
+	if projectDir != "" {
+		if rel, err := filepath.Rel(projectDir, filename); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			filename = rel
+		}
+	}
+	return filepath.ToSlash(filename)
+}
+
+// newFileReport returns the report for the provided result. fileErrs are the errors that occurred while formatting or
+// writing the file.
+func newFileReport(result amalgomatedformatter.Result, fileErrs []FileError, projectDir string, diffContext int) FileReport {
+	fileReport := FileReport{
+		Path:            reportPath(result.Filename, projectDir),
+		Status:          StatusFormatted,
+		Generated:       result.Generated,
+		RewriteRules:    result.RewriteRules,
+		Simplifications: result.Simplifications,
+	}
+	if result.Skipped {
+		fileReport.Status = StatusSkipped
+	}
+	if result.Changed() {
+		fileReport.Status = StatusChanged
+		fileReport.Hunks = amalgomatedformatter.DiffHunks(result.Src, result.Formatted, diffContext)
+	}
+	if len(fileErrs) > 0 {
+		fileReport.Status = StatusError
+		fileReport.Errors = fileErrs
+	}
+	return fileReport
+}
+
+// newBaselinedFileReport returns the report for the provided result for a file that is in the baseline.
+func newBaselinedFileReport(result amalgomatedformatter.Result, projectDir string) FileReport {
+	return FileReport{
+		Path:      reportPath(result.Filename, projectDir),
+		Status:    StatusBaselined,
+		Generated: result.Generated,
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// WriteCheckstyleReport writes report to w as Checkstyle XML with an element for every file. Every change that
+// formatting makes to a file is reported as an error at the first line that changes and errors that prevent a file
+// from being formatted are reported at their position.
+func WriteCheckstyleReport(w io.Writer, report Report) error {
+	out := checkstyleReport{
+		Version: "5.0",
+	}
+	for _, file := range report.Files {
+		checkstyleFile := checkstyleFile{
+			Name: file.Path,
+		}
+		for _, c := range changes(file.Hunks) {
+			checkstyleFile.Errors = append(checkstyleFile.Errors, checkstyleError{
+				Line:     c.startLine,
+				Severity: "error",
+				Message:  changeMessage(c),
+				Source:   unformattedRuleID,
+			})
+		}
+		for _, fileErr := range file.Errors {
+			checkstyleFile.Errors = append(checkstyleFile.Errors, checkstyleError{
+				Line:     fileErr.Line,
+				Column:   fileErr.Column,
+				Severity: "error",
+				Message:  fileErr.Msg,
+				Source:   parseErrorRuleID,
+			})
+		}
+		out.Files = append(out.Files, checkstyleFile)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// The types below define the Checkstyle XML schema used by reports.
+
+type checkstyleReport struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
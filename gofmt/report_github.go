@@ -0,0 +1,71 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteGitHubReport writes report to w as GitHub Actions workflow commands. Every change that formatting makes to a
+// file and every error that prevents a file from being formatted is written as an "::error" command so that it is
+// shown as an annotation of the file. The commands only take effect when they are written to the standard output of a
+// workflow step.
+func WriteGitHubReport(w io.Writer, report Report) error {
+	for _, file := range report.Files {
+		for _, c := range changes(file.Hunks) {
+			if err := writeGitHubCommand(w, [][2]string{
+				{"file", file.Path},
+				{"line", fmt.Sprint(c.startLine)},
+				{"endLine", fmt.Sprint(c.endLine())},
+				{"title", unformattedRuleID},
+			}, changeMessage(c)); err != nil {
+				return err
+			}
+		}
+		for _, fileErr := range file.Errors {
+			props := [][2]string{
+				{"file", file.Path},
+			}
+			if fileErr.Line > 0 {
+				props = append(props, [2]string{"line", fmt.Sprint(fileErr.Line)})
+			}
+			if fileErr.Column > 0 {
+				props = append(props, [2]string{"col", fmt.Sprint(fileErr.Column)})
+			}
+			props = append(props, [2]string{"title", parseErrorRuleID})
+			if err := writeGitHubCommand(w, props, fileErr.Msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeGitHubCommand writes an "::error" workflow command with the provided properties and message.
+func writeGitHubCommand(w io.Writer, props [][2]string, msg string) error {
+	var parts []string
+	for _, prop := range props {
+		parts = append(parts, prop[0]+"="+gitHubPropertyEscaper.Replace(prop[1]))
+	}
+	_, err := fmt.Fprintf(w, "::error %s::%s\n", strings.Join(parts, ","), gitHubDataEscaper.Replace(msg))
+	return err
+}
+
+var (
+	gitHubDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	gitHubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
@@ -0,0 +1,118 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSONReportVersion is the version of the schema of JSON reports. It is incremented whenever a change to the schema
+// is not backwards compatible: fields may be added without changing the version.
+const JSONReportVersion = 1
+
+// WriteJSONReport writes report to w as a JSON object with the following schema:
+//
+//	{
+//	  "version": 1,                  // JSONReportVersion
+//	  "files": [                     // every file that was processed, in the order in which it was provided
+//	    {
+//	      "path": "pkg/foo.go",      // path relative to the project directory using the slash separator
+//	      "status": "changed",       // "formatted", "changed", "error", "skipped" or "baselined"
+//	      "generated": true,         // whether the file is generated; omitted if false
+//	      "hunks": [                 // diff between the original and formatted content; omitted if not "changed"
+//	        {
+//	          "oldStart": 3,         // range of the hunk in the original content as printed in the hunk header
+//	          "oldLines": 4,
+//	          "newStart": 3,         // range of the hunk in the formatted content
+//	          "newLines": 4,
+//	          "lines": [" import (", "-\t_ \"os\"", ...] // lines prefixed with ' ', '-' or '+'
+//	        }
+//	      ],
+//	      "rewriteRules": ["slice-len"],         // names of the rewrite rules that matched; omitted if none
+//	      "simplifications": ["range"],          // names of the simplifications that changed the file; omitted if none
+//	      "errors": [                            // omitted unless "error"
+//	        {"line": 3, "column": 11, "message": "expected ')', found '{'"} // line and column are 0 if unknown
+//	      ]
+//	    }
+//	  ]
+//	}
+func WriteJSONReport(w io.Writer, report Report) error {
+	out := jsonReport{
+		Version: JSONReportVersion,
+		Files:   []jsonFileReport{},
+	}
+	for _, file := range report.Files {
+		jsonFile := jsonFileReport{
+			Path:            file.Path,
+			Status:          string(file.Status),
+			Generated:       file.Generated,
+			RewriteRules:    file.RewriteRules,
+			Simplifications: file.Simplifications,
+		}
+		for _, hunk := range file.Hunks {
+			jsonFile.Hunks = append(jsonFile.Hunks, jsonHunk{
+				OldStart: hunk.OldStart,
+				OldLines: hunk.OldLines,
+				NewStart: hunk.NewStart,
+				NewLines: hunk.NewLines,
+				Lines:    hunk.Lines,
+			})
+		}
+		for _, fileErr := range file.Errors {
+			jsonFile.Errors = append(jsonFile.Errors, jsonError{
+				Line:    fileErr.Line,
+				Column:  fileErr.Column,
+				Message: fileErr.Msg,
+			})
+		}
+		out.Files = append(out.Files, jsonFile)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// The types below define the JSON schema. They are distinct from the report types so that the schema does not change
+// when the report types do.
+
+type jsonReport struct {
+	Version int              `json:"version"`
+	Files   []jsonFileReport `json:"files"`
+}
+
+type jsonFileReport struct {
+	Path            string      `json:"path"`
+	Status          string      `json:"status"`
+	Generated       bool        `json:"generated,omitempty"`
+	Hunks           []jsonHunk  `json:"hunks,omitempty"`
+	RewriteRules    []string    `json:"rewriteRules,omitempty"`
+	Simplifications []string    `json:"simplifications,omitempty"`
+	Errors          []jsonError `json:"errors,omitempty"`
+}
+
+type jsonHunk struct {
+	OldStart int      `json:"oldStart"`
+	OldLines int      `json:"oldLines"`
+	NewStart int      `json:"newStart"`
+	NewLines int      `json:"newLines"`
+	Lines    []string `json:"lines"`
+}
+
+type jsonError struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// WriteJUnitReport writes report to w as JUnit XML with a single "gofmt" test suite that contains a test case for
+// every file. Files that are changed by formatting are reported as failures whose content is the unified diff of the
+// change, files that cannot be formatted are reported as errors and generated files that were skipped and files in the
+// baseline are reported as skipped.
+func WriteJUnitReport(w io.Writer, report Report) error {
+	suite := junitTestSuite{
+		Name:  TypeName,
+		Tests: len(report.Files),
+	}
+	for _, file := range report.Files {
+		testCase := junitTestCase{
+			Name:      file.Path,
+			ClassName: TypeName,
+		}
+		switch file.Status {
+		case StatusChanged:
+			suite.Failures++
+			testCase.Failure = &junitResult{
+				Message:  file.Path + " is not formatted",
+				Type:     unformattedRuleID,
+				Contents: fileDiff(file),
+			}
+		case StatusSkipped:
+			suite.Skipped++
+			testCase.Skipped = &junitSkipped{
+				Message: file.Path + " is generated",
+			}
+		case StatusBaselined:
+			suite.Skipped++
+			testCase.Skipped = &junitSkipped{
+				Message: file.Path + " is in the baseline",
+			}
+		case StatusError:
+			suite.Errors++
+			var msgs []string
+			for _, fileErr := range file.Errors {
+				// identify the file by its path in the report
+				fileErr.Filename = file.Path
+				msgs = append(msgs, fileErr.Error())
+			}
+			testCase.Error = &junitResult{
+				Message:  file.Path + " cannot be formatted",
+				Type:     parseErrorRuleID,
+				Contents: strings.Join(msgs, "\n"),
+			}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitTestSuites{
+		TestSuites: []junitTestSuite{suite},
+	}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// The types below define the JUnit XML schema used by reports.
+
+type junitTestSuites struct {
+	XMLName    xml.Name         `xml:"testsuites"`
+	TestSuites []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr,omitempty"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitResult  `xml:"failure,omitempty"`
+	Error     *junitResult  `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitResult struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr"`
+	Contents string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
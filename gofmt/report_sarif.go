@@ -0,0 +1,219 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	// sarifSrcRoot is the URI base ID of the project directory, to which the paths in reports are relative.
+	sarifSrcRoot = "%SRCROOT%"
+)
+
+// WriteSARIFReport writes report to w as a SARIF 2.1.0 log with a single run. Every change that formatting makes to
+// a file is reported as a "gofmt/unformatted" result located at the lines that change, with a fix that replaces those
+// lines with the formatted lines. Errors are reported as "gofmt/parse-error" results. Artifact locations are relative
+// to the "%SRCROOT%" base URI, which is the project directory.
+func WriteSARIFReport(w io.Writer, report Report) error {
+	run := sarifRun{
+		Tool: sarifTool{
+			Driver: sarifDriver{
+				Name:           TypeName,
+				InformationURI: "https://golang.org/cmd/gofmt",
+				Rules: []sarifRule{
+					{
+						ID:               unformattedRuleID,
+						ShortDescription: sarifMessage{Text: "File is not formatted with gofmt."},
+					},
+					{
+						ID:               parseErrorRuleID,
+						ShortDescription: sarifMessage{Text: "File cannot be formatted with gofmt."},
+					},
+				},
+			},
+		},
+		Results: []sarifResult{},
+	}
+	for _, file := range report.Files {
+		artifact := sarifArtifactLocation{
+			URI:       file.Path,
+			URIBaseID: sarifSrcRoot,
+		}
+		for _, c := range changes(file.Hunks) {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:  unformattedRuleID,
+				Level:   "error",
+				Message: sarifMessage{Text: changeMessage(c)},
+				Locations: []sarifLocation{
+					{
+						PhysicalLocation: sarifPhysicalLocation{
+							ArtifactLocation: artifact,
+							Region: &sarifRegion{
+								StartLine: c.startLine,
+								EndLine:   c.endLine(),
+							},
+						},
+					},
+				},
+				Fixes: []sarifFix{
+					{
+						Description: sarifMessage{Text: "Format with gofmt."},
+						ArtifactChanges: []sarifArtifactChange{
+							{
+								ArtifactLocation: artifact,
+								Replacements: []sarifReplacement{
+									{
+										// replace entire lines including their line terminators
+										DeletedRegion: sarifRegion{
+											StartLine:   c.startLine,
+											StartColumn: 1,
+											EndLine:     c.startLine + len(c.removed),
+											EndColumn:   1,
+										},
+										InsertedContent: &sarifArtifactContent{
+											Text: joinLines(c.added),
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			})
+		}
+		for _, fileErr := range file.Errors {
+			result := sarifResult{
+				RuleID:  parseErrorRuleID,
+				Level:   "error",
+				Message: sarifMessage{Text: fileErr.Msg},
+				Locations: []sarifLocation{
+					{
+						PhysicalLocation: sarifPhysicalLocation{
+							ArtifactLocation: artifact,
+						},
+					},
+				},
+			}
+			if fileErr.Line > 0 {
+				result.Locations[0].PhysicalLocation.Region = &sarifRegion{
+					StartLine:   fileErr.Line,
+					StartColumn: fileErr.Column,
+				}
+			}
+			run.Results = append(run.Results, result)
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	})
+}
+
+// joinLines returns lines terminated by newlines.
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// The types below define the subset of the SARIF 2.1.0 schema that is used in reports.
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules,omitempty"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+	Fixes     []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine,omitempty"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion           `json:"deletedRegion"`
+	InsertedContent *sarifArtifactContent `json:"insertedContent,omitempty"`
+}
+
+type sarifArtifactContent struct {
+	Text string `json:"text"`
+}
@@ -0,0 +1,211 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	amalgomatedformatter "github.com/palantir/godel-format-asset-gofmt/generated_src"
+)
+
+// Reporter writes a report of the outcome of formatting files in a specific format.
+type Reporter interface {
+	WriteReport(w io.Writer, report Report) error
+}
+
+// ReporterFunc is a function that implements Reporter.
+type ReporterFunc func(w io.Writer, report Report) error
+
+func (f ReporterFunc) WriteReport(w io.Writer, report Report) error {
+	return f(w, report)
+}
+
+// ReportFormat is the name of the format of a report.
+type ReportFormat string
+
+const (
+	// JSONReportFormat is the JSON report format documented by WriteJSONReport.
+	JSONReportFormat ReportFormat = "json"
+	// SARIFReportFormat is the SARIF 2.1.0 format.
+	SARIFReportFormat ReportFormat = "sarif"
+	// JUnitReportFormat is the JUnit XML format.
+	JUnitReportFormat ReportFormat = "junit"
+	// CheckstyleReportFormat is the Checkstyle XML format.
+	CheckstyleReportFormat ReportFormat = "checkstyle"
+	// GitHubReportFormat is the format of GitHub Actions workflow commands.
+	GitHubReportFormat ReportFormat = "github"
+)
+
+// reporters are the reporters for each supported format. Supporting a new format only requires adding its reporter.
+var reporters = map[ReportFormat]Reporter{
+	JSONReportFormat:       ReporterFunc(WriteJSONReport),
+	SARIFReportFormat:      ReporterFunc(WriteSARIFReport),
+	JUnitReportFormat:      ReporterFunc(WriteJUnitReport),
+	CheckstyleReportFormat: ReporterFunc(WriteCheckstyleReport),
+	GitHubReportFormat:     ReporterFunc(WriteGitHubReport),
+}
+
+// ReportFormats returns the names of the supported report formats in alphabetical order.
+func ReportFormats() []ReportFormat {
+	var formats []ReportFormat
+	for format := range reporters {
+		formats = append(formats, format)
+	}
+	sort.Slice(formats, func(i, j int) bool {
+		return formats[i] < formats[j]
+	})
+	return formats
+}
+
+// ParseReportFormat returns the ReportFormat with the provided name.
+func ParseReportFormat(name string) (ReportFormat, error) {
+	format := ReportFormat(name)
+	if _, ok := reporters[format]; !ok {
+		var names []string
+		for _, format := range ReportFormats() {
+			names = append(names, string(format))
+		}
+		return "", errors.Errorf("unknown report format %q: must be one of %s", name, strings.Join(names, ", "))
+	}
+	return format, nil
+}
+
+// NewReporter returns the Reporter for the provided format.
+func NewReporter(format ReportFormat) (Reporter, error) {
+	if _, err := ParseReportFormat(string(format)); err != nil {
+		return nil, err
+	}
+	return reporters[format], nil
+}
+
+// StdoutReportPath is the report path that specifies that a report is written to standard output.
+const StdoutReportPath = "-"
+
+// ReportOutput configures a report that is written after all of the files have been processed.
+type ReportOutput struct {
+	Format ReportFormat
+	// Path is the path of the report file. A relative path is resolved against the project directory. If Path is
+	// StdoutReportPath, the report is written to standard output after the output for the files.
+	Path string
+}
+
+// ParseReportOutput parses a report specified as "<format>=<path>".
+func ParseReportOutput(spec string) (ReportOutput, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return ReportOutput{}, errors.Errorf("invalid report %q: must be of the form <format>=<path>", spec)
+	}
+	format, err := ParseReportFormat(parts[0])
+	if err != nil {
+		return ReportOutput{}, err
+	}
+	return ReportOutput{
+		Format: format,
+		Path:   parts[1],
+	}, nil
+}
+
+// WriteCommandReports writes the reports specified by the "-report" flags of the gofmt command, which are of the form
+// "<format>=<path>", for the provided results. Paths are relative to the working directory.
+func WriteCommandReports(specs []string, results []amalgomatedformatter.Result) error {
+	var outputs []ReportOutput
+	for _, spec := range specs {
+		output, err := ParseReportOutput(spec)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, output)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return errors.Wrapf(err, "failed to determine working directory")
+	}
+	var report Report
+	for _, result := range results {
+		var fileErrs []FileError
+		if result.Err != nil {
+			fileErrs = newFileErrors(result.Filename, result.Err)
+		}
+		report.Files = append(report.Files, newFileReport(result, fileErrs, wd, amalgomatedformatter.DefaultDiffContext))
+	}
+	return writeReports(outputs, report, wd, os.Stdout)
+}
+
+// writeReports writes the report to each of the outputs.
+func writeReports(outputs []ReportOutput, report Report, projectDir string, stdout io.Writer) error {
+	for _, output := range outputs {
+		reporter, err := NewReporter(output.Format)
+		if err != nil {
+			return err
+		}
+		if output.Path == StdoutReportPath {
+			if err := reporter.WriteReport(stdout, report); err != nil {
+				return errors.Wrapf(err, "failed to write %s report", output.Format)
+			}
+			continue
+		}
+		if err := writeReportFile(reporter, report, output, projectDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeReportFile writes the report to the file specified by output.
+func writeReportFile(reporter Reporter, report Report, output ReportOutput, projectDir string) error {
+	path := output.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(projectDir, path)
+	}
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		return reporter.WriteReport(w, report)
+	}); err != nil {
+		return errors.Wrapf(err, "failed to write %s report %s", output.Format, path)
+	}
+	return nil
+}
+
+// writeFileAtomic creates or replaces the file at path with the content written by write. Missing parent directories
+// are created. The file is replaced only once its content has been written successfully.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
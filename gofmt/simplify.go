@@ -0,0 +1,73 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	amalgomatedformatter "github.com/palantir/godel-format-asset-gofmt/generated_src"
+)
+
+// SimplifyRules returns the names of the simplification rules performed by "gofmt -s", each of which can be skipped
+// individually.
+func SimplifyRules() []string {
+	return amalgomatedformatter.Simplifications()
+}
+
+// ExtraSimplifyRules returns the names of the extra simplification rules, which are not performed by "gofmt -s" and
+// are only applied if they are enabled individually.
+func ExtraSimplifyRules() []string {
+	return amalgomatedformatter.ExtraSimplifications()
+}
+
+// ValidateSimplifyRules returns an error if any of the provided names is not the name of a simplification rule.
+func ValidateSimplifyRules(names []string) error {
+	return validateRules("simplification rule", names, SimplifyRules())
+}
+
+// ValidateExtraSimplifyRules returns an error if any of the provided names is not the name of an extra simplification
+// rule.
+func ValidateExtraSimplifyRules(names []string) error {
+	return validateRules("extra simplification rule", names, ExtraSimplifyRules())
+}
+
+func validateRules(kind string, names, rules []string) error {
+	for _, name := range names {
+		if !containsString(rules, name) {
+			return errors.Errorf("unknown %s %q: must be one of %s", kind, name, strings.Join(rules, ", "))
+		}
+	}
+	return nil
+}
+
+// simplifyRules returns the names of the simplification rules that are applied if the provided rules are skipped and
+// the provided extra rules are enabled, or nil if all of the simplification rules and none of the extra rules are
+// applied. If skipSimplify is true, only the extra rules are applied.
+func simplifyRules(skipSimplify bool, skip, extra []string) []string {
+	if !skipSimplify && len(skip) == 0 && len(extra) == 0 {
+		return nil
+	}
+	rules := []string{}
+	if !skipSimplify {
+		for _, rule := range SimplifyRules() {
+			if !containsString(skip, rule) {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return append(rules, extra...)
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofmt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	amalgomatedformatter "github.com/palantir/godel-format-asset-gofmt/generated_src"
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/internal/git"
+)
+
+// stagedFiles provides and updates the content of files that is staged in the git index.
+type stagedFiles struct {
+	// dir is the absolute path of the directory in which git is run.
+	dir string
+	// files are the provided files that are staged, in the order in which they were provided.
+	files []string
+	// entries are the index entries of files keyed by the names with which they were provided.
+	entries map[string]git.IndexEntry
+	// updateWorkingTree writes the formatted content to files in the working tree whose content is identical to the
+	// staged content.
+	updateWorkingTree bool
+}
+
+// readStagedFiles returns the staged content of the provided files in the git repository that contains projectDir, or
+// the working directory if projectDir is empty. Files that are not regular files in the index are ignored.
+func readStagedFiles(files []string, projectDir string, updateWorkingTree bool) (*stagedFiles, error) {
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to determine absolute path of %q", projectDir)
+	}
+	entries, err := git.IndexEntries(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read git index")
+	}
+	staged := &stagedFiles{
+		dir:               dir,
+		entries:           make(map[string]git.IndexEntry),
+		updateWorkingTree: updateWorkingTree,
+	}
+	for _, file := range files {
+		absFile, err := filepath.Abs(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to determine absolute path of %q", file)
+		}
+		entry, ok := entries[absFile]
+		if !ok || !entry.Regular() {
+			continue
+		}
+		staged.files = append(staged.files, file)
+		staged.entries[file] = entry
+	}
+	return staged, nil
+}
+
+// read returns the staged content of the provided file.
+func (s *stagedFiles) read(filename string) ([]byte, error) {
+	entry := s.entries[filename]
+	if entry.Stage != 0 {
+		return nil, errors.Errorf("%s has unresolved conflicts", filename)
+	}
+	src, err := git.ReadBlob(s.dir, entry.Object)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read staged content of %s", filename)
+	}
+	return src, nil
+}
+
+// write stages the formatted content of the provided result. If s.updateWorkingTree is true and the file in the
+// working tree is identical to the staged content, the file is updated as well. Otherwise, the working tree is not
+// modified, so unstaged changes to partially staged files are preserved.
+func (s *stagedFiles) write(result amalgomatedformatter.Result) error {
+	if !result.Changed() {
+		return nil
+	}
+	entry := s.entries[result.Filename]
+	object, err := git.WriteBlob(s.dir, result.Formatted)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write formatted content of %s", result.Filename)
+	}
+	entry.Object = object
+	if err := git.UpdateIndex(s.dir, entry); err != nil {
+		return errors.Wrapf(err, "failed to stage formatted content of %s", result.Filename)
+	}
+	if !s.updateWorkingTree {
+		return nil
+	}
+	if src, err := ioutil.ReadFile(result.Filename); err != nil || !bytes.Equal(src, result.Src) {
+		// the file is partially staged or cannot be read, so it is left unchanged
+		return nil
+	}
+	return result.Write()
+}
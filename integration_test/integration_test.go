@@ -15,13 +15,20 @@
 package integration_test
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/nmiyake/pkg/gofiles"
+	"github.com/palantir/godel-format-plugin/formatplugin"
+	"github.com/palantir/godel-format-plugin/formatter"
 	"github.com/palantir/godel-format-plugin/formattester"
 	"github.com/palantir/godel/v2/framework/pluginapitester"
 	"github.com/palantir/godel/v2/pkg/products"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -146,6 +153,81 @@ func Foo() {
 		_ = "foo"
 	}
 }
+`,
+					}
+				},
+			},
+			{
+				Name: "applies rewrite rules",
+				Specs: []gofiles.GoFileSpec{
+					{
+						RelPath: "foo.go",
+						Src: `package foo
+
+func Foo(s []string) []string {
+	return s[0:]
+}
+`,
+					},
+				},
+				ConfigFiles: map[string]string{
+					"godel/config/godel.yml": godelYML,
+					"godel/config/format-plugin.yml": `
+formatters:
+  gofmt:
+    config:
+      version: 1
+      rewrite-rules:
+        - "a[0:] -> a"
+`,
+				},
+				WantFiles: func(specFiles map[string]gofiles.GoFile) map[string]string {
+					return map[string]string{
+						"foo.go": `package foo
+
+func Foo(s []string) []string {
+	return s
+}
+`,
+					}
+				},
+			},
+			{
+				Name: "formats files in a subprocess",
+				Specs: []gofiles.GoFileSpec{
+					{
+						RelPath: "foo.go",
+						Src: `package foo
+
+func Foo(s []string) []string {
+	for _ = range s {
+	}
+	return s[0:]
+}
+`,
+					},
+				},
+				ConfigFiles: map[string]string{
+					"godel/config/godel.yml": godelYML,
+					"godel/config/format-plugin.yml": `
+formatters:
+  gofmt:
+    config:
+      version: 1
+      subprocess: true
+      rewrite-rules:
+        - "a[0:] -> a"
+`,
+				},
+				WantFiles: func(specFiles map[string]gofiles.GoFile) map[string]string {
+					return map[string]string{
+						"foo.go": `package foo
+
+func Foo(s []string) []string {
+	for range s {
+	}
+	return s
+}
 `,
 					}
 				},
@@ -183,6 +265,33 @@ import (
 )
 
 func Foo() {}
+`,
+					}
+				},
+			},
+			{
+				Name: "verify fails for files that cannot be parsed",
+				Specs: []gofiles.GoFileSpec{
+					{
+						RelPath: "foo.go",
+						Src: `package foo
+
+func Foo( {}
+`,
+					},
+				},
+				ConfigFiles: configFiles,
+				Verify:      true,
+				WantError:   true,
+				WantOutput: func(projectDir string) string {
+					return fmt.Sprintf(`%s/foo.go
+`, projectDir)
+				},
+				WantFiles: func(specFiles map[string]gofiles.GoFile) map[string]string {
+					return map[string]string{
+						"foo.go": `package foo
+
+func Foo( {}
 `,
 					}
 				},
@@ -191,6 +300,61 @@ func Foo() {}
 	)
 }
 
+// TestVerifyOutputFile verifies files through the format plugin, which runs "run-format --list" and only shows the lines
+// of its output that consist of a file name, and verifies that the complete output is written to the output file.
+func TestVerifyOutputFile(t *testing.T) {
+	assetPath, err := products.Bin("gofmt-asset")
+	require.NoError(t, err)
+	creators, _, err := formatter.AssetFormatterCreators(assetPath)
+	require.NoError(t, err)
+	require.Len(t, creators, 1)
+
+	projectDir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(projectDir)
+	}()
+	file := filepath.Join(projectDir, "foo.go")
+	src := "package foo\n\nfunc Foo(s []int) []int {\n\tfor _ = range s {\n\t}\n\treturn s[1:len(s)]\n}\n"
+	require.NoError(t, ioutil.WriteFile(file, []byte(src), 0644))
+
+	gofmtFormatter, err := creators[0].Creator()([]byte(`version: 1
+rewrite-rules:
+  - name: slice-len
+    rule: a[b:len(a)] -> a[b:]
+verify:
+  show-diff: true
+  diff-context: 0
+  output-file: out/verify.txt
+`))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	err = formatplugin.Run(formatplugin.Param{
+		Formatters: []formatplugin.Formatter{gofmtFormatter},
+	}, projectDir, true, nil, buf)
+	require.Error(t, err)
+	assert.Equal(t, file+"\n", buf.String())
+
+	output, err := ioutil.ReadFile(filepath.Join(projectDir, "out", "verify.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, file+"\n"+
+		file+`: rewrite rule "slice-len" matched`+"\n"+
+		file+`: simplification rule "range" applied`+"\n"+
+		"--- "+filepath.ToSlash(file)+".orig\n"+
+		"+++ "+filepath.ToSlash(file)+"\n"+
+		"@@ -4 +4 @@\n"+
+		"-\tfor _ = range s {\n"+
+		"+\tfor range s {\n"+
+		"@@ -6 +6 @@\n"+
+		"-\treturn s[1:len(s)]\n"+
+		"+\treturn s[1:]\n", string(output))
+
+	// the source is not modified when verifying
+	content, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, src, string(content))
+}
+
 func TestUpgradeConfig(t *testing.T) {
 	pluginProvider, err := pluginapitester.NewPluginProviderFromLocator(formatPluginLocator, formatPluginResolver)
 	require.NoError(t, err)
@@ -203,6 +367,52 @@ func TestUpgradeConfig(t *testing.T) {
 		pluginProvider,
 		[]pluginapitester.AssetProvider{assetProvider},
 		[]pluginapitester.UpgradeConfigTestCase{
+			{
+				Name: "v0 configuration is upgraded to v1",
+				ConfigFiles: map[string]string{
+					"godel/config/format-plugin.yml": `
+# comment
+formatters:
+  gofmt:
+    config:
+      # inner comment
+      skip-simplify: true
+      skip-cache: true
+      concurrency: 4
+`,
+				},
+				WantOutput: "Upgraded configuration for format-plugin.yml\n",
+				WantFiles: map[string]string{
+					"godel/config/format-plugin.yml": `formatters:
+  gofmt:
+    config:
+      version: "1"
+      skip-simplify: true
+      skip-cache: true
+      concurrency: 4
+`,
+				},
+			},
+			{
+				Name: "empty v0 configuration is not upgraded",
+				ConfigFiles: map[string]string{
+					"godel/config/format-plugin.yml": `
+# comment
+formatters:
+  gofmt:
+    config: {}
+`,
+				},
+				WantOutput: "",
+				WantFiles: map[string]string{
+					"godel/config/format-plugin.yml": `
+# comment
+formatters:
+  gofmt:
+    config: {}
+`,
+				},
+			},
 			{
 				Name: "current configuration is not upgraded",
 				ConfigFiles: map[string]string{
@@ -212,6 +422,7 @@ formatters:
   gofmt:
     config:
       # inner comment
+      version: 1
       skip-simplify: true
 `,
 				},
@@ -223,6 +434,7 @@ formatters:
   gofmt:
     config:
       # inner comment
+      version: 1
       skip-simplify: true
 `,
 				},
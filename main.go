@@ -16,25 +16,197 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 
 	"github.com/palantir/amalgomate/amalgomated"
 	"github.com/palantir/godel-format-plugin/formatter"
+	godelconfig "github.com/palantir/godel/v2/framework/godel/config"
+	"github.com/palantir/godel/v2/framework/godellauncher"
 	"github.com/palantir/pkg/cobracli"
+	"github.com/palantir/pkg/matcher"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
 
 	amalgomatedformatter "github.com/palantir/godel-format-asset-gofmt/generated_src"
+	"github.com/palantir/godel-format-asset-gofmt/gofmt"
 	"github.com/palantir/godel-format-asset-gofmt/gofmt/config"
 	"github.com/palantir/godel-format-asset-gofmt/gofmt/creator"
+	"github.com/palantir/godel-format-asset-gofmt/gofmt/hook"
 )
 
-const assetName = "gofmt"
+const (
+	assetName        = "gofmt"
+	runFormatCmdName = "run-format"
+
+	projectDirFlagName = "project-dir"
+	configYMLFlagName  = "config-yml"
+)
 
 func main() {
 	if len(os.Args) >= 2 && os.Args[1] == amalgomated.ProxyCmdPrefix+assetName {
 		os.Args = append(os.Args[:1], os.Args[2:]...)
+		amalgomatedformatter.SetReportHandler(gofmt.WriteCommandReports)
 		amalgomatedformatter.Instance().Run(assetName)
 		os.Exit(0)
 	}
 
-	rootCmd := formatter.AssetRootCmd(creator.Gofmt(), config.UpgradeConfig, "")
+	var flags creator.Flags
+	rootCmd := formatter.AssetRootCmd(creator.GofmtWithFlags(&flags), config.UpgradeConfig, "")
+	addRunFormatFlags(rootCmd, &flags)
+	rootCmd.AddCommand(newInstallHookCmd(), newUninstallHookCmd(), newBaselineCmd())
 	os.Exit(cobracli.ExecuteWithDefaultParams(rootCmd))
 }
+
+// addRunFormatFlags adds the flags that configure the formatter to the "run-format" command created by the format
+// plugin. The flags can only be used when the asset is invoked directly.
+func addRunFormatFlags(rootCmd *cobra.Command, flags *creator.Flags) {
+	for _, cmd := range rootCmd.Commands() {
+		if cmd.Name() != runFormatCmdName {
+			continue
+		}
+		cmd.Flags().StringVar(&flags.ChangedSince, "changed-since", "", "only format files that differ from the provided git commit or branch (overrides the changed-since configuration)")
+		cmd.Flags().BoolVar(&flags.Staged, "staged", false, "format the content of files that is staged in the git index rather than the content in the working tree")
+		cmd.Flags().StringArrayVar(&flags.LineRanges, "line-ranges", nil, "only apply formatting changes that overlap the provided lines of a file, specified as <path>:<start>-<end>[,...] (may be repeated; overrides the line-ranges configuration)")
+	}
+}
+
+func newInstallHookCmd() *cobra.Command {
+	var (
+		projectDirFlagVal string
+		configYMLFlagVal  string
+	)
+	cmd := &cobra.Command{
+		Use:   "install-hook",
+		Short: "Install a git pre-commit hook that verifies that staged Go files are formatted",
+		Long: `Install a git pre-commit hook in the repository that contains the project directory. The hook runs this asset
+with the provided configuration to verify that the staged content of the Go files in the project directory is
+formatted. An existing pre-commit hook is preserved and run by the installed hook before the check. The configuration
+is stored in the hook when it is installed, so the hook must be reinstalled after the configuration changes.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// fail before installing a hook that would reject every commit: the hook formats staged files
+			formatter, err := creator.GofmtWithFlags(&creator.Flags{Staged: true}).Creator()([]byte(configYMLFlagVal))
+			if err != nil {
+				return err
+			}
+			gofmtFormatter, ok := formatter.(*gofmt.Formatter)
+			if !ok {
+				return errors.Errorf("unexpected formatter type %T", formatter)
+			}
+			if err := gofmtFormatter.Validate(); err != nil {
+				return errors.Wrapf(err, "configuration cannot be used by the hook")
+			}
+			assetPath, err := os.Executable()
+			if err != nil {
+				return errors.Wrapf(err, "failed to determine executable")
+			}
+			hookPath, err := hook.Install(projectDirFlagVal, assetPath, configYMLFlagVal)
+			if err != nil {
+				return err
+			}
+			cmd.Printf("Installed %s hook %s\n", hook.Name, hookPath)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&projectDirFlagVal, projectDirFlagName, "", "project directory (defaults to the working directory)")
+	cmd.Flags().StringVar(&configYMLFlagVal, configYMLFlagName, "", "YML of formatter configuration used by the hook")
+	return cmd
+}
+
+func newUninstallHookCmd() *cobra.Command {
+	var projectDirFlagVal string
+	cmd := &cobra.Command{
+		Use:   "uninstall-hook",
+		Short: "Uninstall the git pre-commit hook installed by install-hook",
+		Long: `Uninstall the git pre-commit hook installed by install-hook from the repository that contains the project
+directory. The pre-commit hook that existed when the hook was installed is restored.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hookPath, err := hook.Uninstall(projectDirFlagVal)
+			if err != nil {
+				return err
+			}
+			if hookPath == "" {
+				cmd.Printf("No %s hook is installed\n", hook.Name)
+				return nil
+			}
+			cmd.Printf("Uninstalled %s hook %s\n", hook.Name, hookPath)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&projectDirFlagVal, projectDirFlagName, "", "project directory (defaults to the working directory)")
+	return cmd
+}
+
+func newBaselineCmd() *cobra.Command {
+	var (
+		projectDirFlagVal string
+		configYMLFlagVal  string
+		baselineFlagVal   string
+	)
+	cmd := &cobra.Command{
+		Use:   "baseline [files]",
+		Short: "Record the Go files that are not formatted in a baseline file",
+		Long: `Record the Go files that are not formatted, along with the hashes of their content, in the baseline file specified
+by the baseline configuration or flag. Files in the baseline are not verified until their content changes, but they are
+still formatted. The baseline is replaced, so files that are formatted are removed from it. If no files are provided,
+all of the Go files in the project directory that are not excluded by the exclude configuration of the gödel project are
+used, which are the files that the format plugin verifies.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			formatter, err := creator.Gofmt().Creator()([]byte(configYMLFlagVal))
+			if err != nil {
+				return err
+			}
+			gofmtFormatter, ok := formatter.(*gofmt.Formatter)
+			if !ok {
+				return errors.Errorf("unexpected formatter type %T", formatter)
+			}
+			if baselineFlagVal != "" {
+				gofmtFormatter.Baseline = baselineFlagVal
+			}
+			files := args
+			if len(files) == 0 {
+				if files, err = projectGoFiles(projectDirFlagVal); err != nil {
+					return err
+				}
+			}
+			count, err := gofmtFormatter.UpdateBaseline(files, projectDirFlagVal)
+			if _, ok := err.(*gofmt.FormatError); err != nil && !ok {
+				return err
+			}
+			cmd.Printf("Recorded %d file(s) that are not formatted in baseline %s\n", count, gofmtFormatter.Baseline)
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&projectDirFlagVal, projectDirFlagName, "", "project directory (defaults to the working directory)")
+	cmd.Flags().StringVar(&configYMLFlagVal, configYMLFlagName, "", "YML of formatter configuration")
+	cmd.Flags().StringVar(&baselineFlagVal, "baseline", "", "path of the baseline file (overrides the baseline configuration)")
+	return cmd
+}
+
+// projectGoFiles returns the Go files in projectDir and its subdirectories that are not excluded by the exclude
+// configuration in the godel.yml file of the gödel project in projectDir. These are the files that the format plugin
+// formats when no files are provided.
+func projectGoFiles(projectDir string) ([]string, error) {
+	dir := projectDir
+	if dir == "" {
+		dir = "."
+	}
+	cfgDir, err := godellauncher.ConfigDirPath(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to determine gödel configuration directory of %s: provide the files to record explicitly", dir)
+	}
+	exclude, err := godelconfig.ReadGodelConfigExcludesFromFile(filepath.Join(cfgDir, godellauncher.GodelConfigYML))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read exclude configuration")
+	}
+	relPaths, err := matcher.ListFiles(dir, matcher.Name(`.*\.go`), exclude.Matcher())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list Go files in %s", dir)
+	}
+	files := make([]string, len(relPaths))
+	for i, relPath := range relPaths {
+		files[i] = filepath.Join(dir, relPath)
+	}
+	return files, nil
+}